@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Self-service account management. Deleting an account removes the users
+// row, which takes the player's name, email and password hash with it;
+// bankroll_audit rows keep only the user ID and game_bets rows lose their
+// user ID, so the financial trail and bet history survive for audit.
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// UpdateProfileRequest changes the fields that are present. Email is only
+// accepted so it can be refused with a pointer to the email change flow.
+type UpdateProfileRequest struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Email     *string `json:"email"`
+}
+
+func handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	var req UpdateProfileRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Email != nil {
+		writeError(w, r, http.StatusBadRequest, "Email cannot be changed here; use the email change flow", "EMAIL_CHANGE_NOT_ALLOWED")
+		return
+	}
+	if req.FirstName == nil && req.LastName == nil {
+		writeError(w, r, http.StatusBadRequest, "Nothing to update", "INVALID_REQUEST")
+		return
+	}
+	var fields []FieldError
+	if req.FirstName != nil {
+		if fe := validateName("first_name", "First name", *req.FirstName); fe != nil {
+			fields = append(fields, *fe)
+		}
+	}
+	if req.LastName != nil {
+		if fe := validateName("last_name", "Last name", *req.LastName); fe != nil {
+			fields = append(fields, *fe)
+		}
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+
+	res, err := db.Exec(`
+		UPDATE users SET first_name = COALESCE($1, first_name), last_name = COALESCE($2, last_name)
+		WHERE id = $3
+	`, req.FirstName, req.LastName, userID)
+	if err != nil {
+		slog.Error("Failed to update profile", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		writeUserLookupError(w, r, sql.ErrNoRows)
+		return
+	}
+	user, err := getUserByID(userID)
+	if err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		slog.Error("Failed to encode user response", "err", err)
+	}
+}
+
+func handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	var req DeleteAccountRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Password == "" {
+		writeError(w, r, http.StatusBadRequest, "Password is required", "MISSING_FIELDS")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	defer rollback(tx)
+
+	var hash string
+	var balance int64
+	err = tx.QueryRow("SELECT password_hash, bankroll_cents FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&hash, &balance)
+	if err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)); err != nil {
+		writeError(w, r, http.StatusUnauthorized, "Invalid credentials", "INVALID_CREDENTIALS")
+		return
+	}
+
+	// Open hands are abandoned, keeping their stake, and the game services
+	// are told to close them once the deletion commits.
+	rows, err := tx.Query("SELECT id, game FROM game_bets WHERE user_id = $1 AND status = 'active'", userID)
+	if err != nil {
+		slog.Error("Failed to list active sessions", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	var closed []map[string]interface{}
+	for rows.Next() {
+		var betID, game string
+		if err := rows.Scan(&betID, &game); err != nil {
+			rows.Close()
+			slog.Error("Failed to list active sessions", "user_id", userID, "err", err)
+			writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+			return
+		}
+		closed = append(closed, map[string]interface{}{
+			"session_id": betID, "user_id": userID, "game": game, "reason": reasonAccountClosed,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.Error("Failed to list active sessions", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+
+	// Record the forfeited balance so the audit trail ends at zero.
+	if balance > 0 {
+		if _, err := writeBankrollChange(tx, userID, -balance, reasonAccountClosed, "", false); err != nil {
+			slog.Error("Failed to record closing balance", "user_id", userID, "err", err)
+			writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+			return
+		}
+	}
+	if _, err := tx.Exec(`
+		UPDATE game_bets SET status = 'abandoned', settled_at = now() WHERE user_id = $1 AND status = 'active'
+	`, userID); err != nil {
+		slog.Error("Failed to abandon active sessions", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = $1", userID); err != nil {
+		slog.Error("Failed to delete user", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit account deletion", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+
+	slog.Info("User deleted their account", "user_id", userID, "forfeited_cents", balance)
+	for _, data := range closed {
+		notifyWebhook(eventSessionForceClosed, data)
+	}
+	notifyWebhook(eventUserDeleted, map[string]interface{}{"user_id": userID})
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
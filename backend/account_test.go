@@ -0,0 +1,50 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeleteAccountKeepsBetHistory(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+	setTestPassword(t, userID, "hunter22")
+	settled, err := placeBet(userID, gameBlackjack, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := settleBet(userID, gameBlackjack, 1000, outcomeLost); err != nil {
+		t.Fatal(err)
+	}
+	open, err := placeBet(userID, gamePoker, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleDeleteAccount(rec, userRequest("DELETE", "/api/account", userID, `{"password":"hunter22"}`))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	for betID, want := range map[string]string{settled: outcomeLost, open: "abandoned"} {
+		var user sql.NullString
+		var status string
+		if err := db.QueryRow("SELECT user_id, status FROM game_bets WHERE id = $1", betID).Scan(&user, &status); err != nil {
+			t.Fatalf("bet %s: %v", betID, err)
+		}
+		if user.Valid || status != want {
+			t.Errorf("bet %s: user_id = %v, status = %q; want NULL, %q", betID, user, status, want)
+		}
+	}
+
+	if _, err := reverseSession(settled, "test"); !errors.Is(err, errAccountDeleted) {
+		t.Errorf("reverseSession err = %v, want errAccountDeleted", err)
+	}
+	if _, err := raiseBet(open, 1000); !errors.Is(err, errAccountDeleted) {
+		t.Errorf("raiseBet err = %v, want errAccountDeleted", err)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Support-staff endpoints. Callers are either a logged-in user with the
+// admin role, or an automated client presenting the shared ADMIN_API_KEY in
+// the X-Admin-Key header.
+
+const maxAdminNoteLength = 500
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+var (
+	errNegativeBalance = errors.New("adjustment would make balance negative")
+	errNotReversible   = errors.New("session is not settled")
+	errAccountDeleted  = errors.New("session belongs to a deleted account")
+)
+
+type AdjustBankrollRequest struct {
+	DeltaCents int64  `json:"delta_cents"`
+	Reason     string `json:"reason"`
+}
+
+type AdjustBankrollResponse struct {
+	UserID        string `json:"user_id"`
+	BankrollCents int64  `json:"bankroll_cents"`
+}
+
+type ReverseSessionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RaiseSessionRequest adds to the amount committed to an active hand, such
+// as a poker raise after the blinds.
+type RaiseSessionRequest struct {
+	AmountCents int64 `json:"amount_cents"`
+}
+
+type RaiseSessionResponse struct {
+	SessionID     string `json:"session_id"`
+	BetCents      int64  `json:"bet_cents"`
+	BankrollCents int64  `json:"bankroll_cents"`
+}
+
+type ReverseSessionResponse struct {
+	SessionID     string `json:"session_id"`
+	DeltaCents    int64  `json:"delta_cents"`
+	BankrollCents int64  `json:"bankroll_cents"`
+}
+
+// AdminStatsResponse summarises the play-money economy. Wagered and house
+// profit cover bets placed in [from, to); the other figures are current.
+// Reversed bets count as wagered but not toward profit.
+type AdminStatsResponse struct {
+	From                       *time.Time `json:"from"`
+	To                         *time.Time `json:"to"`
+	TotalUsers                 int64      `json:"total_users"`
+	BankrollInCirculationCents int64      `json:"bankroll_in_circulation_cents"`
+	ActiveSessions             int64      `json:"active_sessions"`
+	WageredCents               int64      `json:"wagered_cents"`
+	HouseProfitCents           int64      `json:"house_profit_cents"`
+	// HouseEdgePercent is the configured edge of each backend-drawn game.
+	HouseEdgePercent map[string]float64 `json:"house_edge_percent"`
+}
+
+// adminAccessMiddleware accepts a valid X-Admin-Key, or otherwise falls back
+// to session auth plus the admin role.
+func adminAccessMiddleware(next http.Handler) http.Handler {
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	sessionAuth := authMiddleware(csrfMiddleware(requireRole(roleAdmin)(next)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Admin-Key")
+		if key == "" {
+			sessionAuth.ServeHTTP(w, r)
+			return
+		}
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+			writeError(w, r, http.StatusForbidden, "Forbidden", "FORBIDDEN")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminAdjustBankroll applies a signed correction to a user's balance
+// and records it in bankroll_audit with the staff-supplied reason.
+func handleAdminAdjustBankroll(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !uuidPattern.MatchString(userID) {
+		writeError(w, r, http.StatusBadRequest, "Invalid user ID", "INVALID_REQUEST")
+		return
+	}
+	var req AdjustBankrollRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.DeltaCents == 0 {
+		writeError(w, r, http.StatusBadRequest, "delta_cents must be non-zero", "INVALID_REQUEST")
+		return
+	}
+	if req.Reason == "" || len(req.Reason) > maxAdminNoteLength {
+		writeError(w, r, http.StatusBadRequest, "A reason of at most 500 characters is required", "INVALID_REQUEST")
+		return
+	}
+
+	balance, err := adminAdjustBankroll(userID, req.DeltaCents, req.Reason)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, r, http.StatusNotFound, "User not found", "USER_NOT_FOUND")
+		return
+	case errors.Is(err, errNegativeBalance):
+		writeError(w, r, http.StatusBadRequest, "Adjustment would make the balance negative", "NEGATIVE_BALANCE")
+		return
+	case errors.Is(err, errBankrollCapReached):
+		writeError(w, r, http.StatusConflict, "Adjustment would take the balance over the maximum", "BANKROLL_CAP_REACHED")
+		return
+	case err != nil:
+		slog.Error("Failed to adjust bankroll", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	slog.Info("Admin adjusted bankroll", "user_id", userID, "delta_cents", req.DeltaCents, "reason", req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(AdjustBankrollResponse{UserID: userID, BankrollCents: balance}); err != nil {
+		slog.Error("Failed to encode adjust bankroll response", "err", err)
+	}
+}
+
+func adminAdjustBankroll(userID string, delta int64, note string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(tx)
+
+	var balance int64
+	if err := tx.QueryRow("SELECT bankroll_cents FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&balance); err != nil {
+		return 0, err
+	}
+	if balance+delta < 0 {
+		return 0, errNegativeBalance
+	}
+	balance, err = correctBankroll(tx, userID, delta, note)
+	if err != nil {
+		return 0, err
+	}
+	return balance, tx.Commit()
+}
+
+// handleAdminStats reports platform totals. from and to are optional dates
+// (YYYY-MM-DD); to is inclusive.
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	var from, to sql.NullTime
+	for _, p := range []struct {
+		name string
+		dst  *sql.NullTime
+		days int
+	}{
+		{"from", &from, 0},
+		{"to", &to, 1},
+	} {
+		raw := r.URL.Query().Get(p.name)
+		if raw == "" {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, p.name+" must be a date like 2024-01-31", "INVALID_REQUEST")
+			return
+		}
+		*p.dst = sql.NullTime{Time: day.AddDate(0, 0, p.days), Valid: true}
+	}
+	if from.Valid && to.Valid && !from.Time.Before(to.Time) {
+		writeError(w, r, http.StatusBadRequest, "from must not be after to", "INVALID_REQUEST")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), reportQueryTimeout)
+	defer cancel()
+	var resp AdminStatsResponse
+	err := readDB.QueryRowContext(ctx, `
+		SELECT
+			(SELECT count(*) FROM users),
+			(SELECT coalesce(sum(bankroll_cents), 0) FROM users),
+			(SELECT count(*) FROM game_bets WHERE status = 'active'),
+			coalesce(sum(bet_cents + coalesce(insurance_cents, 0)), 0),
+			coalesce(sum(bet_cents - coalesce(payout_cents, 0)
+				+ coalesce(insurance_cents, 0) - coalesce(insurance_payout_cents, 0)) FILTER (WHERE status NOT IN ('active', 'reversed')), 0)
+		FROM game_bets
+		WHERE ($1::timestamptz IS NULL OR created_at >= $1)
+		  AND ($2::timestamptz IS NULL OR created_at < $2)
+	`, from, to).Scan(&resp.TotalUsers, &resp.BankrollInCirculationCents, &resp.ActiveSessions,
+		&resp.WageredCents, &resp.HouseProfitCents)
+	if err != nil {
+		writeQueryError(w, r, err, "Failed to compute admin stats")
+		return
+	}
+	resp.HouseEdgePercent = make(map[string]float64)
+	for game := range winProbability {
+		resp.HouseEdgePercent[game], _ = houseEdgePercent(game)
+	}
+	if from.Valid {
+		resp.From = &from.Time
+	}
+	if to.Valid {
+		resp.To = &to.Time
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode admin stats response", "err", err)
+	}
+}
+
+// handleAdminReverseSession undoes a settled hand: the player gets back a
+// lost stake, or gives back the profit on a win, and the bet is marked
+// reversed so it cannot be reversed twice.
+func handleAdminReverseSession(w http.ResponseWriter, r *http.Request) {
+	betID := mux.Vars(r)["sessionId"]
+	if !uuidPattern.MatchString(betID) {
+		writeError(w, r, http.StatusBadRequest, "Invalid session ID", "INVALID_REQUEST")
+		return
+	}
+	var req ReverseSessionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Reason == "" || len(req.Reason) > maxAdminNoteLength {
+		writeError(w, r, http.StatusBadRequest, "A reason of at most 500 characters is required", "INVALID_REQUEST")
+		return
+	}
+
+	resp, err := reverseSession(betID, req.Reason)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, r, http.StatusNotFound, "Session not found", "NOT_FOUND")
+		return
+	case errors.Is(err, errNotReversible):
+		writeError(w, r, http.StatusConflict, "Only a settled session can be reversed, and only once", "NOT_REVERSIBLE")
+		return
+	case errors.Is(err, errAccountDeleted):
+		writeError(w, r, http.StatusConflict, "The session's account has been deleted", "ACCOUNT_DELETED")
+		return
+	case errors.Is(err, errNegativeBalance):
+		writeError(w, r, http.StatusBadRequest, "Reversal would make the balance negative", "NEGATIVE_BALANCE")
+		return
+	case errors.Is(err, errBankrollCapReached):
+		writeError(w, r, http.StatusConflict, "Reversal would take the balance over the maximum", "BANKROLL_CAP_REACHED")
+		return
+	case err != nil:
+		slog.Error("Failed to reverse session", "bet_id", betID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	slog.Info("Admin reversed session", "bet_id", betID, "delta_cents", resp.DeltaCents, "reason", req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode reverse session response", "err", err)
+	}
+}
+
+func reverseSession(betID, note string) (ReverseSessionResponse, error) {
+	resp := ReverseSessionResponse{SessionID: betID}
+	tx, err := db.Begin()
+	if err != nil {
+		return resp, err
+	}
+	defer rollback(tx)
+
+	var user sql.NullString
+	var game, status string
+	var bet int64
+	var payout, insurance, insurancePayout sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT user_id, game, status, bet_cents, payout_cents, insurance_cents, insurance_payout_cents
+		FROM game_bets WHERE id = $1 FOR UPDATE
+	`, betID).Scan(&user, &game, &status, &bet, &payout, &insurance, &insurancePayout)
+	if err != nil {
+		return resp, err
+	}
+	// A deleted account's bets are kept without a user; there is no
+	// bankroll left to correct.
+	if !user.Valid {
+		return resp, errAccountDeleted
+	}
+	userID := user.String
+	var counter string
+	switch status {
+	case outcomeWon:
+		counter = gameAccounts[game].WinCounter
+	case outcomeLost:
+		counter = gameAccounts[game].LossCounter
+	case outcomePush, "abandoned":
+	default:
+		return resp, errNotReversible
+	}
+
+	var balance int64
+	if err := tx.QueryRow("SELECT bankroll_cents FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&balance); err != nil {
+		return resp, err
+	}
+	// The hand moved payout - bet, plus the same for any insurance; undo
+	// exactly that.
+	resp.DeltaCents = bet - payout.Int64 + insurance.Int64 - insurancePayout.Int64
+	resp.BankrollCents = balance
+	if resp.DeltaCents != 0 {
+		if balance+resp.DeltaCents < 0 {
+			return resp, errNegativeBalance
+		}
+		resp.BankrollCents, err = writeBankrollChange(tx, userID, resp.DeltaCents, reasonBetReversal, note, false)
+		if err != nil {
+			return resp, err
+		}
+	}
+	if counter != "" {
+		if _, err := tx.Exec("UPDATE users SET "+counter+" = GREATEST("+counter+" - 1, 0) WHERE id = $1", userID); err != nil {
+			return resp, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE game_bets SET status = 'reversed' WHERE id = $1", betID); err != nil {
+		return resp, err
+	}
+	return resp, tx.Commit()
+}
+
+// handleAdminRaiseSession takes a further stake for an active hand from the
+// player's bankroll. The hand's bet_cents becomes the total committed, and
+// settlement pays out on that total.
+func handleAdminRaiseSession(w http.ResponseWriter, r *http.Request) {
+	betID := mux.Vars(r)["sessionId"]
+	if !uuidPattern.MatchString(betID) {
+		writeError(w, r, http.StatusBadRequest, "Invalid session ID", "INVALID_REQUEST")
+		return
+	}
+	var req RaiseSessionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.AmountCents <= 0 {
+		writeError(w, r, http.StatusBadRequest, "amount_cents must be positive", "INVALID_BET")
+		return
+	}
+
+	resp, err := raiseBet(betID, req.AmountCents)
+	switch {
+	case errors.Is(err, errSessionNotFound):
+		writeError(w, r, http.StatusNotFound, "Session not found", "NOT_FOUND")
+		return
+	case errors.Is(err, errNoActiveBet):
+		writeError(w, r, http.StatusConflict, "Only an active session can be raised", "SESSION_NOT_ACTIVE")
+		return
+	case errors.Is(err, errAccountDeleted):
+		writeError(w, r, http.StatusConflict, "The session's account has been deleted", "ACCOUNT_DELETED")
+		return
+	case err != nil:
+		writeBetError(w, r, err)
+		return
+	}
+	slog.Info("Raised session bet", "bet_id", betID, "amount_cents", req.AmountCents, "bet_cents", resp.BetCents)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode raise session response", "err", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// APIError is an error with the response it should produce: an HTTP status,
+// a machine-readable code and a message safe to show the client. Code that
+// can fail in a client-visible way returns one, and writeAPIError renders it,
+// so each status and code pairing is decided where the error is made rather
+// than in every handler that passes it on.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	// RetryAfter, when set, is sent as the Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// errInternal hides the cause of an unexpected failure from the client; the
+// cause is logged instead.
+var errInternal = &APIError{Status: http.StatusInternalServerError, Code: "INTERNAL_ERROR", Message: "Server error"}
+
+func badRequest(code, message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: code, Message: message}
+}
+
+func forbidden(code, message string) *APIError {
+	return &APIError{Status: http.StatusForbidden, Code: code, Message: message}
+}
+
+func conflict(code, message string) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: code, Message: message}
+}
+
+func unavailable(code, message string, retryAfter time.Duration) *APIError {
+	return &APIError{Status: http.StatusServiceUnavailable, Code: code, Message: message, RetryAfter: retryAfter}
+}
+
+// validationFailed lists every invalid field. The message joins the field
+// messages for clients that do not read fields.
+func validationFailed(fields []FieldError) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: "VALIDATION_FAILED", Message: fieldErrorSummary(fields), Fields: fields}
+}
+
+// writeAPIError renders err. Anything that is not an APIError is logged and
+// reported as a 500 without detail.
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		slog.Error("Unhandled error", "path", r.URL.Path, "err", err)
+		apiErr = errInternal
+	}
+	if apiErr.RetryAfter > 0 {
+		setRetryAfter(w, apiErr.RetryAfter)
+	}
+	writeErrorResponse(w, apiErr.Status, ErrorResponse{
+		Error:     apiErr.Message,
+		Code:      apiErr.Code,
+		Fields:    apiErr.Fields,
+		RequestID: requestIDFromContext(r.Context()),
+	})
+}
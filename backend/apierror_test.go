@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteAPIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantMsg    string
+		wantRetry  string
+	}{
+		{"bad request", badRequest("INVALID_BET", "Invalid bet"), http.StatusBadRequest, "INVALID_BET", "Invalid bet", ""},
+		{"wrapped", fmt.Errorf("start hand: %w", conflict("GAME_IN_PROGRESS", "Finish your hand")), http.StatusConflict, "GAME_IN_PROGRESS", "Finish your hand", ""},
+		{"retry after", unavailable("TRY_AGAIN", "Try again", 1500*time.Millisecond), http.StatusServiceUnavailable, "TRY_AGAIN", "Try again", "2"},
+		{"plain error", errors.New("pq: connection refused"), http.StatusInternalServerError, "INTERNAL_ERROR", "Server error", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/user/me", nil)
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey, "req-9"))
+			rec := httptest.NewRecorder()
+			writeAPIError(rec, r, tt.err)
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.wantStatus || resp.Code != tt.wantCode || resp.Error != tt.wantMsg || resp.RequestID != "req-9" {
+				t.Errorf("got %d %+v, want %d %s %q", rec.Code, resp, tt.wantStatus, tt.wantCode, tt.wantMsg)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetry)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+		})
+	}
+}
+
+func TestValidationFailedAPIError(t *testing.T) {
+	fields := []FieldError{{"email", "Email is required"}, {"password", "Password is required"}}
+	rec := httptest.NewRecorder()
+	writeAPIError(rec, httptest.NewRequest("POST", "/api/auth/register", nil), validationFailed(fields))
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest || resp.Code != "VALIDATION_FAILED" || len(resp.Fields) != 2 ||
+		resp.Error != "Email is required; Password is required" {
+		t.Errorf("got %d %+v", rec.Code, resp)
+	}
+}
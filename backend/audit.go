@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Reasons recorded in bankroll_audit.
+const (
+	reasonBlackjackBet       = "blackjack_bet"
+	reasonBlackjackRefund    = "blackjack_refund"
+	reasonBlackjackWin       = "blackjack_win"
+	reasonBlackjackPush      = "blackjack_push"
+	reasonBlackjackSurrender = "blackjack_surrender"
+	reasonBlackjackInsurance = "blackjack_insurance"
+	reasonInsuranceWin       = "blackjack_insurance_win"
+	reasonPokerBet           = "poker_bet"
+	reasonPokerRefund        = "poker_refund"
+	reasonPokerWin           = "poker_win"
+	reasonPokerPush          = "poker_push"
+	reasonCoinflipBet        = "coinflip_bet"
+	reasonCoinflipRefund     = "coinflip_refund"
+	reasonCoinflipWin        = "coinflip_win"
+	reasonAdminAdjustment    = "admin_adjustment"
+	reasonAccountClosed      = "account_closed"
+	reasonPromoBonus         = "promo_bonus"
+	reasonBetReversal        = "bet_reversal"
+)
+
+// Categories group audit reasons for filtering. Loss and deposit have no
+// writer yet: a lost hand moves no money at settlement, and there is no way
+// to buy chips.
+const (
+	categoryBet        = "bet"
+	categoryWin        = "win"
+	categoryLoss       = "loss"
+	categoryPush       = "push"
+	categoryDeposit    = "deposit"
+	categoryWithdraw   = "withdraw"
+	categoryBonus      = "bonus"
+	categoryRefund     = "refund"
+	categoryReversal   = "reversal"
+	categoryAdjustment = "adjustment"
+)
+
+// auditCategories lists every category bankroll_audit accepts.
+var auditCategories = []string{
+	categoryBet, categoryWin, categoryLoss, categoryPush, categoryDeposit,
+	categoryWithdraw, categoryBonus, categoryRefund, categoryReversal, categoryAdjustment,
+}
+
+// reasonCategories assigns each reason its category; writeBankrollChange
+// refuses a reason missing here. A surrender hands back half the stake, so
+// it is filed as a refund.
+var reasonCategories = map[string]string{
+	reasonBlackjackBet:       categoryBet,
+	reasonBlackjackRefund:    categoryRefund,
+	reasonBlackjackWin:       categoryWin,
+	reasonBlackjackPush:      categoryPush,
+	reasonBlackjackSurrender: categoryRefund,
+	reasonBlackjackInsurance: categoryBet,
+	reasonInsuranceWin:       categoryWin,
+	reasonPokerBet:           categoryBet,
+	reasonPokerRefund:        categoryRefund,
+	reasonPokerWin:           categoryWin,
+	reasonPokerPush:          categoryPush,
+	reasonCoinflipBet:        categoryBet,
+	reasonCoinflipRefund:     categoryRefund,
+	reasonCoinflipWin:        categoryWin,
+	reasonAdminAdjustment:    categoryAdjustment,
+	reasonAccountClosed:      categoryWithdraw,
+	reasonPromoBonus:         categoryBonus,
+	reasonBetReversal:        categoryReversal,
+}
+
+// adjustBankroll is the single place gameplay changes a user's balance.
+// Inside tx it applies delta, counts it against the user's loss-limit period,
+// and writes a bankroll_audit row with the balance before and after. It
+// returns the new balance.
+func adjustBankroll(tx *sql.Tx, userID string, delta int64, reason string) (int64, error) {
+	return writeBankrollChange(tx, userID, delta, reason, "", true)
+}
+
+// correctBankroll applies a staff correction. It is audited like gameplay
+// but does not count toward the user's loss limit.
+func correctBankroll(tx *sql.Tx, userID string, delta int64, note string) (int64, error) {
+	return writeBankrollChange(tx, userID, delta, reasonAdminAdjustment, note, false)
+}
+
+var errBankrollCapReached = errors.New("bankroll cap reached")
+
+// maxBankrollCents caps a user's balance; a credit that would take it higher
+// fails. Zero means no cap. Set by MAX_BANKROLL_CENTS.
+var maxBankrollCents int64
+
+func loadBankrollCapConfig() error {
+	if v := os.Getenv("MAX_BANKROLL_CENTS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("MAX_BANKROLL_CENTS must be a positive number of cents, got %q", v)
+		}
+		maxBankrollCents = n
+	}
+	return nil
+}
+
+// exceedsBankrollCap reports whether balance is over maxBankrollCents.
+func exceedsBankrollCap(balance int64) bool {
+	return maxBankrollCents > 0 && balance > maxBankrollCents
+}
+
+// returnsStake reports whether reason hands back a stake just taken, as a
+// refund or push does. Those credits are never capped: refusing one after
+// the cap was lowered would keep the player's own money.
+func returnsStake(reason string) bool {
+	for _, acct := range gameAccounts {
+		if reason == acct.RefundReason || reason == acct.PushReason {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBankrollChange applies delta inside tx and audits it. A credit that
+// would take the balance over maxBankrollCents fails with
+// errBankrollCapReached before anything is committed.
+func writeBankrollChange(tx *sql.Tx, userID string, delta int64, reason, note string, countsTowardLimit bool) (int64, error) {
+	category, ok := reasonCategories[reason]
+	if !ok {
+		return 0, fmt.Errorf("bankroll change reason %q has no category", reason)
+	}
+	query := "UPDATE users SET bankroll_cents = bankroll_cents + $1 WHERE id = $2 RETURNING bankroll_cents"
+	if countsTowardLimit {
+		query = "UPDATE users SET bankroll_cents = bankroll_cents + $1, period_loss_cents = period_loss_cents - $1 WHERE id = $2 RETURNING bankroll_cents"
+	}
+	var after int64
+	if err := tx.QueryRow(query, delta, userID).Scan(&after); err != nil {
+		return 0, err
+	}
+	if delta > 0 && exceedsBankrollCap(after) && !returnsStake(reason) {
+		return 0, errBankrollCapReached
+	}
+	_, err := tx.Exec(`
+		INSERT INTO bankroll_audit (user_id, delta_cents, balance_before_cents, balance_after_cents, reason, category, note)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+	`, userID, delta, after-delta, after, reason, category, note)
+	if err != nil {
+		return 0, err
+	}
+	return after, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+// useBankrollCap sets maxBankrollCents for the test.
+func useBankrollCap(t *testing.T, cents int64) {
+	prev := maxBankrollCents
+	maxBankrollCents = cents
+	t.Cleanup(func() { maxBankrollCents = prev })
+}
+
+func TestExceedsBankrollCap(t *testing.T) {
+	tests := []struct {
+		name    string
+		cap     int64
+		balance int64
+		want    bool
+	}{
+		{"no cap", 0, 1 << 62, false},
+		{"under", 10000, 9999, false},
+		{"at", 10000, 10000, false},
+		{"over", 10000, 10001, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useBankrollCap(t, tt.cap)
+			if got := exceedsBankrollCap(tt.balance); got != tt.want {
+				t.Errorf("exceedsBankrollCap(%d) = %v, want %v", tt.balance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBankrollCapConfig(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"100000", 100000, false},
+		{"0", 0, true},
+		{"-5", 0, true},
+		{"10.50", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			useBankrollCap(t, 0)
+			t.Setenv("MAX_BANKROLL_CENTS", tt.value)
+			err := loadBankrollCapConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && maxBankrollCents != tt.want {
+				t.Errorf("maxBankrollCents = %d, want %d", maxBankrollCents, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// GET /api/games/{game}/limits tells the UI what the player may stake on a
+// game right now, combining every rule placeBet applies: the game's
+// increment and admin-set range, coin flip's own bounds, the bankroll,
+// MAX_BET_FRACTION, the loss limit and the bankroll cap. It also reports the
+// conditions that rule out betting entirely. The answer is a snapshot; the
+// bet itself is still checked when it is placed.
+
+// BetLimitsResponse is the range of bets the player may currently place.
+// When CanBet is false, BlockedBy is the error code a bet would get and
+// MaxBetCents is 0.
+type BetLimitsResponse struct {
+	Game           string `json:"game"`
+	MinBetCents    int64  `json:"min_bet_cents"`
+	MaxBetCents    int64  `json:"max_bet_cents"`
+	IncrementCents int64  `json:"increment_cents"`
+	CanBet         bool   `json:"can_bet"`
+	BlockedBy      string `json:"blocked_by,omitempty"`
+}
+
+// externalService returns the client for a game played in a separate
+// service.
+func externalService(game string) (gameService, bool) {
+	switch game {
+	case gameBlackjack:
+		return blackjackService, true
+	case gamePoker:
+		return pokerService, true
+	}
+	return nil, false
+}
+
+func handleGetBetLimits(w http.ResponseWriter, r *http.Request) {
+	game := mux.Vars(r)["game"]
+	if _, ok := gameAccounts[game]; !ok {
+		writeError(w, r, http.StatusNotFound, "Game not found", "NOT_FOUND")
+		return
+	}
+	resp, err := betLimits(r.Context(), r.Header.Get("X-User-ID"), game)
+	if err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode bet limits response", "err", err)
+	}
+}
+
+// betLimits computes the user's current range for game from one read-only
+// snapshot.
+func betLimits(ctx context.Context, userID, game string) (BetLimitsResponse, error) {
+	inc := betIncrement(game)
+	resp := BetLimitsResponse{Game: game, IncrementCents: inc}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return resp, err
+	}
+	defer rollback(tx)
+
+	var bankroll, periodLoss int64
+	var lossLimit sql.NullInt64
+	var period sql.NullString
+	var periodStart time.Time
+	var excludedUntil sql.NullTime
+	var verified bool
+	err = tx.QueryRow(`
+		SELECT bankroll_cents, loss_limit_cents, loss_limit_period, period_loss_cents, period_started_at, self_excluded_until, email_verified
+		FROM users WHERE id = $1
+	`, userID).Scan(&bankroll, &lossLimit, &period, &periodLoss, &periodStart, &excludedUntil, &verified)
+	if err != nil {
+		return resp, err
+	}
+	enabled, rng, err := gameBetRange(tx, game)
+	if err != nil {
+		return resp, err
+	}
+
+	lo, hi := inc, bankroll
+	hiCode := "INSUFFICIENT_FUNDS"
+	lower := func(limit int64, code string) {
+		if limit < hi {
+			hi, hiCode = limit, code
+		}
+	}
+	if rng.min.Valid {
+		lo = max(lo, rng.min.Int64)
+	}
+	if rng.max.Valid {
+		lower(rng.max.Int64, "BET_OUT_OF_RANGE")
+	}
+	if game == gameCoinflip {
+		lo = max(lo, coinflipMinBet)
+		lower(coinflipMaxBet, "INVALID_BET")
+	}
+	lower(maxBetFor(bankroll), "BET_EXCEEDS_FRACTION")
+	if lossLimit.Valid {
+		now := appClock.Now()
+		if length, ok := limitPeriodLength(period.String); ok && now.Sub(periodStart) >= length {
+			periodLoss = 0
+		}
+		lower(lossLimit.Int64-periodLoss, "LOSS_LIMIT_REACHED")
+	}
+	// Round to whole increments: lo up, hi down.
+	lo = (lo + inc - 1) / inc * inc
+	hi = max(hi, 0) / inc * inc
+	if maxBankrollCents > 0 {
+		lower(maxBetUnderCap(game, bankroll, hi, inc), "BANKROLL_CAP_REACHED")
+	}
+	resp.MinBetCents, resp.MaxBetCents = lo, hi
+
+	svc, external := externalService(game)
+	switch {
+	case !verified:
+		resp.BlockedBy = "EMAIL_NOT_VERIFIED"
+	case excludedUntil.Valid && appClock.Now().Before(excludedUntil.Time):
+		resp.BlockedBy = "SELF_EXCLUDED"
+	case !enabled:
+		resp.BlockedBy = "GAME_DISABLED"
+	case external && !svc.Enabled():
+		resp.BlockedBy = "GAME_UNAVAILABLE"
+	case hi < lo:
+		resp.BlockedBy = hiCode
+	}
+	if resp.BlockedBy != "" {
+		resp.MaxBetCents = 0
+	} else {
+		resp.CanBet = true
+	}
+	return resp, nil
+}
+
+// maxBetUnderCap returns the largest multiple of inc up to hi whose best
+// payout keeps the balance within maxBankrollCents, or -1 if none does.
+// Winning pays back at least the stake, so the outcome grows with the bet
+// and the answer can be found by bisection.
+func maxBetUnderCap(game string, bankroll, hi, inc int64) int64 {
+	fits := func(bet int64) bool {
+		return !exceedsBankrollCap(bankroll - bet + maxPayout(game, bet))
+	}
+	if !fits(0) {
+		return -1
+	}
+	lo, top := int64(0), hi/inc
+	for lo < top {
+		mid := lo + (top-lo+1)/2
+		if fits(mid * inc) {
+			lo = mid
+		} else {
+			top = mid - 1
+		}
+	}
+	return lo * inc
+}
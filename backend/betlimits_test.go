@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMaxBetUnderCap(t *testing.T) {
+	tests := []struct {
+		name     string
+		game     string
+		cap      int64
+		bankroll int64
+		hi, inc  int64
+		want     int64
+	}{
+		{"no cap", gameCoinflip, 0, 5000, 5000, 1, 5000},
+		{"room for part of the bankroll", gameCoinflip, 10000, 9000, 9000, 1, 1000},
+		{"room rounded to the increment", gameCoinflip, 10000, 9000, 9000, 300, 900},
+		{"limited by hi", gameCoinflip, 10000, 9000, 500, 1, 500},
+		// A 5/2 natural is blackjack's best outcome: 9000 - b + 5b/2 <= 10000.
+		{"blackjack natural", gameBlackjack, 10000, 9000, 9000, 1, 667},
+		{"at the cap", gameCoinflip, 10000, 10000, 10000, 1, 0},
+		{"over the cap", gameCoinflip, 10000, 10001, 10001, 1, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useBankrollCap(t, tt.cap)
+			if got := maxBetUnderCap(tt.game, tt.bankroll, tt.hi, tt.inc); got != tt.want {
+				t.Errorf("maxBetUnderCap = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func getBetLimits(t *testing.T, userID, game string) BetLimitsResponse {
+	t.Helper()
+	r := mux.SetURLVars(userRequest("GET", "/api/games/"+game+"/limits", userID, ""), map[string]string{"game": game})
+	rec := httptest.NewRecorder()
+	handleGetBetLimits(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp BetLimitsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestBetLimitsUnknownGame(t *testing.T) {
+	r := mux.SetURLVars(userRequest("GET", "/api/games/roulette/limits", "user-1", ""), map[string]string{"game": "roulette"})
+	rec := httptest.NewRecorder()
+	handleGetBetLimits(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestBetLimits(t *testing.T) {
+	openTestDB(t)
+	useFakeBlackjack(t)
+	tests := []struct {
+		name     string
+		game     string
+		cap      int64
+		bankroll int64
+		want     BetLimitsResponse
+	}{
+		{"coin flip bounds", gameCoinflip, 0, 500000,
+			BetLimitsResponse{MinBetCents: 100, MaxBetCents: 100000, IncrementCents: 1, CanBet: true}},
+		{"poker rounds to whole dollars", gamePoker, 0, 1050,
+			BetLimitsResponse{MinBetCents: 100, MaxBetCents: 1000, IncrementCents: 100, CanBet: true}},
+		{"zero balance", gameBlackjack, 0, 0,
+			BetLimitsResponse{MinBetCents: 1, IncrementCents: 1, BlockedBy: "INSUFFICIENT_FUNDS"}},
+		{"under the cap", gameCoinflip, 10000, 9000,
+			BetLimitsResponse{MinBetCents: 100, MaxBetCents: 1000, IncrementCents: 1, CanBet: true}},
+		{"at the cap", gameBlackjack, 10000, 10000,
+			BetLimitsResponse{MinBetCents: 1, IncrementCents: 1, BlockedBy: "BANKROLL_CAP_REACHED"}},
+		{"over the cap", gameBlackjack, 10000, 10001,
+			BetLimitsResponse{MinBetCents: 1, IncrementCents: 1, BlockedBy: "BANKROLL_CAP_REACHED"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useBankrollCap(t, tt.cap)
+			userID := createTestUser(t, tt.bankroll)
+			tt.want.Game = tt.game
+			got := getBetLimits(t, userID, tt.game)
+			if got != tt.want {
+				t.Fatalf("limits = %+v, want %+v", got, tt.want)
+			}
+			if !got.CanBet {
+				return
+			}
+			// The reported maximum is a bet placeBet accepts.
+			if _, err := placeBet(userID, tt.game, got.MaxBetCents); err != nil {
+				t.Errorf("placeBet(max %d): %v", got.MaxBetCents, err)
+			}
+		})
+	}
+}
+
+func TestBetLimitsGameServiceDown(t *testing.T) {
+	openTestDB(t)
+	useFakeBlackjack(t).disabled = true
+	userID := createTestUser(t, 10000)
+
+	got := getBetLimits(t, userID, gameBlackjack)
+	if got.CanBet || got.BlockedBy != "GAME_UNAVAILABLE" || got.MaxBetCents != 0 {
+		t.Errorf("limits = %+v, want blocked by GAME_UNAVAILABLE", got)
+	}
+}
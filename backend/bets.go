@@ -0,0 +1,456 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every bet is recorded in game_bets in the same transaction that deducts it,
+// and settled from that record. The game services decide who won; they never
+// decide how much money moves.
+
+const (
+	gameBlackjack = "blackjack"
+	gamePoker     = "poker"
+)
+
+// Outcomes a game service can report for a hand.
+const (
+	outcomeWon  = "won"
+	outcomeLost = "lost"
+	outcomePush = "push"
+)
+
+var (
+	errNoActiveBet     = errors.New("no active bet")
+	errSessionNotFound = errors.New("session not found")
+	errGameInProgress  = errors.New("game already in progress")
+	errTooManyGames    = errors.New("too many active games")
+	errInsuranceTaken  = errors.New("insurance already taken")
+	errNotInsurable    = errors.New("bet too small to insure")
+	errUnknownGame     = errors.New("unknown game")
+	errUnknownOutcome  = errors.New("unknown outcome")
+)
+
+// gameAccounting names the audit reasons and win/loss counter columns used
+// when money moves for a game.
+type gameAccounting struct {
+	BetReason    string
+	RefundReason string
+	WinReason    string
+	PushReason   string
+	// SurrenderReason is set for games that let the player give up a hand
+	// for part of the stake.
+	SurrenderReason string
+	WinCounter      string
+	LossCounter     string
+}
+
+var gameAccounts = map[string]gameAccounting{
+	gameBlackjack: {
+		BetReason:       reasonBlackjackBet,
+		RefundReason:    reasonBlackjackRefund,
+		WinReason:       reasonBlackjackWin,
+		PushReason:      reasonBlackjackPush,
+		SurrenderReason: reasonBlackjackSurrender,
+		WinCounter:      "blackjack_wins",
+		LossCounter:     "blackjack_losses",
+	},
+	gamePoker: {
+		BetReason:    reasonPokerBet,
+		RefundReason: reasonPokerRefund,
+		WinReason:    reasonPokerWin,
+		PushReason:   reasonPokerPush,
+		WinCounter:   "poker_wins",
+		LossCounter:  "poker_losses",
+	},
+	gameCoinflip: {
+		BetReason:    reasonCoinflipBet,
+		RefundReason: reasonCoinflipRefund,
+		WinReason:    reasonCoinflipWin,
+	},
+}
+
+// betIncrements is the granularity, in cents, that each game takes bets in.
+// Games not listed accept any number of cents. BET_INCREMENTS overrides it,
+// e.g. "blackjack=500,coinflip=5".
+var betIncrements = map[string]int64{
+	// The poker service works in whole dollars.
+	gamePoker: 100,
+}
+
+// betIncrementError rejects a bet that is not a multiple of the game's
+// increment.
+type betIncrementError struct {
+	increment int64
+}
+
+func (e betIncrementError) Error() string {
+	return fmt.Sprintf("bet must be a multiple of %d cents", e.increment)
+}
+
+func betIncrement(game string) int64 {
+	if n, ok := betIncrements[game]; ok {
+		return n
+	}
+	return 1
+}
+
+func loadBetIncrementConfig() error {
+	for _, entry := range splitList(os.Getenv("BET_INCREMENTS")) {
+		game, value, ok := strings.Cut(entry, "=")
+		game = strings.TrimSpace(game)
+		if !ok {
+			return fmt.Errorf("BET_INCREMENTS entry %q must look like game=cents", entry)
+		}
+		if _, known := gameAccounts[game]; !known {
+			return fmt.Errorf("BET_INCREMENTS entry %q: unknown game %q", entry, game)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("BET_INCREMENTS entry %q: increment must be a positive number of cents", entry)
+		}
+		if game == gamePoker && n%100 != 0 {
+			return fmt.Errorf("BET_INCREMENTS entry %q: poker bets must stay in whole dollars", entry)
+		}
+		betIncrements[game] = n
+	}
+	return nil
+}
+
+// activeBetKey is the unique index allowing one active bet per user and
+// game in database/schema.sql.
+const activeBetKey = "game_bets_user_active_key"
+
+// abandonedBetAge is how long an unsettled hand blocks a new one. The game
+// services drop a hand after an hour without play, so an older active bet
+// can never be settled.
+const abandonedBetAge = time.Hour
+
+// maxActiveGames caps how many games a user may have in progress at once,
+// across all games; each game also allows only one hand at a time. Zero
+// means no cap beyond that. Set by MAX_ACTIVE_SESSIONS.
+var maxActiveGames = 0
+
+func loadActiveGamesConfig() error {
+	if v := os.Getenv("MAX_ACTIVE_SESSIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("MAX_ACTIVE_SESSIONS must be a non-negative integer, got %q", v)
+		}
+		maxActiveGames = n
+	}
+	return nil
+}
+
+// recordBet inserts the active bet for a new hand inside tx and returns its
+// ID. While the user has an unfinished hand of the same game it returns
+// errGameInProgress, so a second tab cannot stake a bet on the same
+// downstream hand. A hand older than abandonedBetAge is marked abandoned
+// first; its stake stays lost. With maxActiveGames set, it returns
+// errTooManyGames once the user has that many other games in progress. The
+// caller must hold the user's row lock so the count cannot race.
+func recordBet(tx *sql.Tx, userID, game string, bet int64) (string, error) {
+	if _, err := tx.Exec(`
+		UPDATE game_bets SET status = 'abandoned', settled_at = now()
+		WHERE user_id = $1 AND game = $2 AND status = 'active' AND created_at < $3
+	`, userID, game, appClock.Now().Add(-abandonedBetAge)); err != nil {
+		return "", err
+	}
+	if maxActiveGames > 0 {
+		// Another hand of the same game is reported as GAME_IN_PROGRESS by
+		// the insert below, so only other games count here.
+		var others int
+		if err := tx.QueryRow(`
+			SELECT count(*) FROM game_bets WHERE user_id = $1 AND game <> $2 AND status = 'active'
+		`, userID, game).Scan(&others); err != nil {
+			return "", err
+		}
+		if others >= maxActiveGames {
+			return "", errTooManyGames
+		}
+	}
+	var betID string
+	err := tx.QueryRow(`
+		INSERT INTO game_bets (user_id, game, bet_cents) VALUES ($1, $2, $3) RETURNING id
+	`, userID, game, bet).Scan(&betID)
+	if isUniqueViolation(err, activeBetKey) {
+		return "", errGameInProgress
+	}
+	return betID, err
+}
+
+// settleBet pays out the user's active bet for game. The payout is computed
+// from the recorded bet and the payout table. reportedBet is what the game
+// service says was staked; it is only cross-checked, and a mismatch is
+// logged as a warning. It returns the amount credited.
+func settleBet(userID, game string, reportedBet int64, outcome string) (int64, error) {
+	acct, ok := gameAccounts[game]
+	if !ok {
+		return 0, errUnknownGame
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(tx)
+
+	// Lock the user before the bet, in the same order as placeBet, so a
+	// settlement and a new bet cannot deadlock.
+	if _, err := tx.Exec("SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return 0, err
+	}
+	var betID string
+	var bet int64
+	err = tx.QueryRow(`
+		SELECT id, bet_cents FROM game_bets
+		WHERE user_id = $1 AND game = $2 AND status = 'active'
+		ORDER BY created_at DESC LIMIT 1 FOR UPDATE
+	`, userID, game).Scan(&betID, &bet)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errNoActiveBet
+	}
+	if err != nil {
+		return 0, err
+	}
+	if reportedBet != bet {
+		slog.Warn("Game service reported a different bet; paying from the recorded bet",
+			"bet_id", betID, "game", game, "recorded_cents", bet, "reported_cents", reportedBet)
+	}
+
+	payout := payoutFor(game, outcome, bet)
+	status := outcome
+	var reason, counter string
+	switch outcome {
+	case outcomeWon, outcomeNatural:
+		status, reason, counter = outcomeWon, acct.WinReason, acct.WinCounter
+	case outcomePush:
+		reason = acct.PushReason
+	case outcomeSurrender:
+		// A surrendered hand is a loss that returns part of the stake.
+		if acct.SurrenderReason == "" {
+			return 0, errUnknownOutcome
+		}
+		status, reason, counter = outcomeLost, acct.SurrenderReason, acct.LossCounter
+	case outcomeLost:
+		counter = acct.LossCounter
+	default:
+		return 0, errUnknownOutcome
+	}
+	if payout > 0 {
+		if _, err := adjustBankroll(tx, userID, payout, reason); err != nil {
+			return 0, err
+		}
+	}
+	if counter != "" {
+		if _, err := tx.Exec("UPDATE users SET "+counter+" = "+counter+" + 1 WHERE id = $1", userID); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(`
+		UPDATE game_bets SET status = $1, payout_cents = $2, settled_at = now() WHERE id = $3
+	`, status, payout, betID); err != nil {
+		return 0, err
+	}
+	return payout, tx.Commit()
+}
+
+// raiseBet deducts amount from the player's bankroll and adds it to the
+// active bet betID, with the same checks as placing a bet. The payout on
+// settlement is then computed from the raised total.
+func raiseBet(betID string, amount int64) (RaiseSessionResponse, error) {
+	resp := RaiseSessionResponse{SessionID: betID}
+	tx, err := db.Begin()
+	if err != nil {
+		return resp, err
+	}
+	defer rollback(tx)
+
+	if err := setLockTimeout(tx); err != nil {
+		return resp, err
+	}
+	// checkStake locks the user before the bet, the order placeBet uses.
+	var user sql.NullString
+	var game string
+	err = tx.QueryRow("SELECT user_id, game FROM game_bets WHERE id = $1", betID).Scan(&user, &game)
+	if errors.Is(err, sql.ErrNoRows) {
+		return resp, errSessionNotFound
+	}
+	if err != nil {
+		return resp, err
+	}
+	if !user.Valid {
+		return resp, errAccountDeleted
+	}
+	userID := user.String
+	if inc := betIncrement(game); amount%inc != 0 {
+		return resp, betIncrementError{increment: inc}
+	}
+	if err := checkStake(tx, userID, amount); err != nil {
+		return resp, err
+	}
+	err = tx.QueryRow(`
+		UPDATE game_bets SET bet_cents = bet_cents + $1
+		WHERE id = $2 AND status = 'active'
+		RETURNING bet_cents
+	`, amount, betID).Scan(&resp.BetCents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return resp, errNoActiveBet
+	}
+	if err != nil {
+		return resp, err
+	}
+	resp.BankrollCents, err = adjustBankroll(tx, userID, -amount, gameAccounts[game].BetReason)
+	if err != nil {
+		return resp, err
+	}
+	if exceedsBankrollCap(resp.BankrollCents + maxPayout(game, resp.BetCents)) {
+		return resp, errBankrollCapReached
+	}
+	return resp, tx.Commit()
+}
+
+// refundBet returns a bet that was deducted before the game service failed.
+func refundBet(betID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	var userID, game string
+	var bet int64
+	err = tx.QueryRow(`
+		SELECT user_id, game, bet_cents FROM game_bets WHERE id = $1 AND status = 'active' FOR UPDATE
+	`, betID).Scan(&userID, &game, &bet)
+	if err != nil {
+		return err
+	}
+	if _, err := adjustBankroll(tx, userID, bet, gameAccounts[game].RefundReason); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE game_bets SET status = 'refunded', payout_cents = $1, settled_at = now() WHERE id = $2
+	`, bet, betID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Insurance is a side bet of half the hand's recorded bet, taken against a
+// dealer ace. Its stake and payout are kept in their own columns on the
+// hand's game_bets row.
+
+// placeInsurance deducts the insurance stake for the user's active blackjack
+// hand and records it. It returns the hand's bet ID and the stake.
+func placeInsurance(userID string) (string, int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", 0, err
+	}
+	defer rollback(tx)
+
+	if err := setLockTimeout(tx); err != nil {
+		return "", 0, err
+	}
+	// Lock the user before the bet, in the same order as placeBet.
+	if _, err := tx.Exec("SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return "", 0, err
+	}
+	var betID string
+	var bet int64
+	var insurance sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT id, bet_cents, insurance_cents FROM game_bets
+		WHERE user_id = $1 AND game = $2 AND status = 'active'
+		ORDER BY created_at DESC LIMIT 1 FOR UPDATE
+	`, userID, gameBlackjack).Scan(&betID, &bet, &insurance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, errNoActiveBet
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if insurance.Valid {
+		return "", 0, errInsuranceTaken
+	}
+	// Half the bet, rounded down; a one-cent bet cannot be insured.
+	stake := bet / 2
+	if stake == 0 {
+		return "", 0, errNotInsurable
+	}
+	if err := checkStake(tx, userID, stake); err != nil {
+		return "", 0, err
+	}
+	if _, err := adjustBankroll(tx, userID, -stake, reasonBlackjackInsurance); err != nil {
+		return "", 0, err
+	}
+	if _, err := tx.Exec("UPDATE game_bets SET insurance_cents = $1 WHERE id = $2", stake, betID); err != nil {
+		return "", 0, err
+	}
+	return betID, stake, tx.Commit()
+}
+
+// settleInsurance pays the insurance on betID if the dealer had blackjack
+// and records the result. It returns the amount credited.
+func settleInsurance(betID string, dealerBlackjack bool) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(tx)
+
+	var userID string
+	var stake int64
+	err = tx.QueryRow(`
+		SELECT user_id, insurance_cents FROM game_bets
+		WHERE id = $1 AND insurance_cents IS NOT NULL AND insurance_payout_cents IS NULL FOR UPDATE
+	`, betID).Scan(&userID, &stake)
+	if err != nil {
+		return 0, err
+	}
+	var payout int64
+	if dealerBlackjack {
+		payout = payoutFor(gameBlackjack, outcomeInsurance, stake)
+		if _, err := adjustBankroll(tx, userID, payout, reasonInsuranceWin); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE game_bets SET insurance_payout_cents = $1 WHERE id = $2", payout, betID); err != nil {
+		return 0, err
+	}
+	return payout, tx.Commit()
+}
+
+// refundInsurance returns an insurance stake that was deducted before the
+// game service failed, so it can be taken again.
+func refundInsurance(betID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	var userID string
+	var stake int64
+	err = tx.QueryRow(`
+		SELECT user_id, insurance_cents FROM game_bets
+		WHERE id = $1 AND insurance_cents IS NOT NULL AND insurance_payout_cents IS NULL FOR UPDATE
+	`, betID).Scan(&userID, &stake)
+	if err != nil {
+		return err
+	}
+	if _, err := adjustBankroll(tx, userID, stake, reasonBlackjackRefund); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE game_bets SET insurance_cents = NULL WHERE id = $1", betID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
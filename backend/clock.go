@@ -0,0 +1,17 @@
+package main
+
+import "time"
+
+// clock supplies the current time to session expiry and refresh, token age
+// and self-exclusion checks. They read appClock instead of calling time.Now,
+// so a fixed or stepped clock can be swapped in to exercise boundaries
+// without sleeping.
+type clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+var appClock clock = systemClock{}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Coin flip, the one game played entirely in the backend. The player calls
+// heads or tails; a correct call pays 2x the bet. The flip is provably fair
+// (see fairness.go): the player first asks for a server seed hash, and the
+// flip uses that seed.
+
+const gameCoinflip = "coinflip"
+
+var (
+	coinflipMinBet int64 = 100
+	coinflipMaxBet int64 = 100000
+)
+
+type CoinflipRequest struct {
+	Bet        int64  `json:"bet"`
+	Call       string `json:"call"`
+	ClientSeed string `json:"client_seed"`
+	// ServerSeedHash, if set, must match the hash issued for the pending
+	// server seed.
+	ServerSeedHash string `json:"server_seed_hash"`
+}
+
+type CoinflipResponse struct {
+	BetID          string `json:"bet_id"`
+	ServerSeedHash string `json:"server_seed_hash"`
+	Nonce          int64  `json:"nonce"`
+	Result         string `json:"result"`
+	Won            bool   `json:"won"`
+	BetCents       int64  `json:"bet_cents"`
+	PayoutCents    int64  `json:"payout_cents"`
+	BankrollCents  int64  `json:"bankroll_cents"`
+	// NextServerSeedHash commits to the seed for the next flip.
+	NextServerSeedHash string `json:"next_server_seed_hash,omitempty"`
+}
+
+func loadCoinflipConfig() error {
+	for _, c := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"COINFLIP_MIN_BET", &coinflipMinBet},
+		{"COINFLIP_MAX_BET", &coinflipMaxBet},
+	} {
+		v := os.Getenv(c.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%s must be a positive number of cents, got %q", c.name, v)
+		}
+		*c.dst = n
+	}
+	if coinflipMinBet > coinflipMaxBet {
+		return errors.New("COINFLIP_MIN_BET must not exceed COINFLIP_MAX_BET")
+	}
+	return nil
+}
+
+func (req CoinflipRequest) validate() error {
+	if req.Call != "heads" && req.Call != "tails" {
+		return badRequest("INVALID_REQUEST", "call must be heads or tails")
+	}
+	if req.Bet < coinflipMinBet || req.Bet > coinflipMaxBet {
+		return badRequest("INVALID_BET", fmt.Sprintf("Bet must be between %d and %d cents", coinflipMinBet, coinflipMaxBet))
+	}
+	if len(req.ClientSeed) > maxClientSeedLength {
+		return badRequest("INVALID_REQUEST", "client_seed must be at most 64 characters")
+	}
+	return nil
+}
+
+func handleCoinflip(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	var req CoinflipRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	betID, err := placeBet(userID, gameCoinflip, req.Bet)
+	if err != nil {
+		writeBetError(w, r, err)
+		return
+	}
+	rng, err := takeServerSeed(userID, req.ClientSeed, req.ServerSeedHash)
+	if err == nil {
+		err = commitServerSeed(betID, rng)
+	}
+	if err != nil {
+		if refundErr := refundBet(betID); refundErr != nil {
+			slog.Error("Failed to refund coin flip bet", "err", refundErr)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			slog.Error("Failed to commit coin flip seed", "err", err)
+		}
+		writeAPIError(w, r, err)
+		return
+	}
+
+	result := "heads"
+	if rng.Intn(2) == 1 {
+		result = "tails"
+	}
+	outcome := outcomeLost
+	if result == req.Call {
+		outcome = outcomeWon
+	}
+
+	payout, err := settleBet(userID, gameCoinflip, req.Bet, outcome)
+	if err != nil {
+		// Settlement rolled back, so the bet is still active; return the
+		// stake rather than leave it to be abandoned.
+		slog.Error("Failed to settle coin flip", "user_id", userID, "err", err)
+		if refundErr := refundBet(betID); refundErr != nil {
+			slog.Error("Failed to refund coin flip bet", "bet_id", betID, "err", refundErr)
+		}
+		apiErr := betAPIError(err)
+		if apiErr == nil {
+			apiErr = errInternal
+		}
+		writeAPIError(w, r, apiErr)
+		return
+	}
+	if err := revealServerSeed(betID, rng); err != nil {
+		slog.Error("Failed to reveal coin flip seed", "bet_id", betID, "err", err)
+	}
+	var bankroll int64
+	if err := db.QueryRow("SELECT bankroll_cents FROM users WHERE id = $1", userID).Scan(&bankroll); err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	next, err := issueServerSeed(userID)
+	if err != nil {
+		slog.Error("Failed to issue next coin flip seed", "user_id", userID, "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := CoinflipResponse{
+		BetID:              betID,
+		ServerSeedHash:     rng.ServerSeedHash(),
+		Nonce:              rng.nonce,
+		Result:             result,
+		Won:                outcome == outcomeWon,
+		BetCents:           req.Bet,
+		PayoutCents:        payout,
+		BankrollCents:      bankroll,
+		NextServerSeedHash: next.ServerSeedHash,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode coin flip response", "err", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Cookie attributes shared by the session and CSRF cookies. Deployments
+// that serve the API and frontend from different subdomains need
+// COOKIE_SAMESITE=none with COOKIE_SECURE=true, a COOKIE_DOMAIN covering
+// both hosts, and the frontend listed in CORS_ALLOWED_ORIGINS.
+var (
+	cookieSameSite = http.SameSiteLaxMode
+	cookieDomain   string
+	cookieSecure   bool
+	// sessionCookieName can be changed with SESSION_COOKIE_NAME when several
+	// apps share a domain.
+	sessionCookieName = "casino_session"
+)
+
+func loadCookieConfig() error {
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "", "lax":
+		cookieSameSite = http.SameSiteLaxMode
+	case "strict":
+		cookieSameSite = http.SameSiteStrictMode
+	case "none":
+		cookieSameSite = http.SameSiteNoneMode
+	default:
+		return fmt.Errorf("COOKIE_SAMESITE must be lax, strict or none, got %q", os.Getenv("COOKIE_SAMESITE"))
+	}
+	cookieDomain = os.Getenv("COOKIE_DOMAIN")
+	if v := os.Getenv("SESSION_COOKIE_NAME"); v != "" {
+		if err := (&http.Cookie{Name: v}).Valid(); err != nil || v == csrfCookieName {
+			return fmt.Errorf("SESSION_COOKIE_NAME %q is not a usable cookie name", v)
+		}
+		sessionCookieName = v
+	}
+	if v := os.Getenv("COOKIE_SECURE"); v != "" {
+		secure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("COOKIE_SECURE must be a boolean, got %q", v)
+		}
+		cookieSecure = secure
+	}
+	if cookieSameSite == http.SameSiteNoneMode && !cookieSecure {
+		return fmt.Errorf("COOKIE_SAMESITE=none requires COOKIE_SECURE=true")
+	}
+	return nil
+}
+
+// newCookie builds a cookie with the configured SameSite, Domain and Secure
+// attributes. A negative maxAge deletes the cookie.
+func newCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   cookieDomain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   cookieSecure,
+		SameSite: cookieSameSite,
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// keepCookieConfig restores the cookie settings loadCookieConfig changes.
+func keepCookieConfig(t *testing.T) {
+	sameSite, domain, secure, name := cookieSameSite, cookieDomain, cookieSecure, sessionCookieName
+	t.Cleanup(func() {
+		cookieSameSite, cookieDomain, cookieSecure, sessionCookieName = sameSite, domain, secure, name
+	})
+}
+
+func TestLoadCookieConfigSessionName(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "casino_session", false},
+		{"app2_session", "app2_session", false},
+		{"bad name", "", true},
+		{"semi;colon", "", true},
+		{csrfCookieName, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			keepCookieConfig(t)
+			sessionCookieName = "casino_session"
+			t.Setenv("SESSION_COOKIE_NAME", tt.value)
+			err := loadCookieConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && sessionCookieName != tt.want {
+				t.Errorf("sessionCookieName = %q, want %q", sessionCookieName, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomSessionCookieName(t *testing.T) {
+	keepCookieConfig(t)
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	sessionCookieName = "app2_session"
+	cookie := sessionCookie(t, "user-1", issued)
+	useClock(t, issued.Add(time.Minute))
+
+	r := httptest.NewRequest("GET", "/api/auth/check", nil)
+	r.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handleAuthCheck(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("custom name: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	// A cookie under the default name is not read.
+	r = httptest.NewRequest("GET", "/api/auth/check", nil)
+	r.AddCookie(&http.Cookie{Name: "casino_session", Value: cookie.Value})
+	rec = httptest.NewRecorder()
+	handleAuthCheck(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("default name: status = %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	clearSessionCookie(rec)
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "app2_session" && c.MaxAge < 0 {
+			return
+		}
+	}
+	t.Errorf("clearSessionCookie did not clear app2_session: %v", rec.Result().Cookies())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// CORS settings. Only origins listed in CORS_ALLOWED_ORIGINS may make
+// credentialed cross-origin requests; by default there are none, which
+// suits the frontend served from the same origin. Any allowed origin can
+// read the CSRF token from /api/auth/csrf, so list only our own frontends.
+// Set CORS_ALLOWED_METHODS or CORS_ALLOWED_HEADERS (comma-separated) to
+// allow more, e.g. PUT or a custom header.
+var (
+	corsAllowedOrigins = map[string]bool{}
+	corsAllowedMethods = []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"}
+	corsAllowedHeaders = []string{"Content-Type", csrfHeaderName}
+)
+
+func loadCORSConfig() error {
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		origins := map[string]bool{}
+		for _, o := range splitList(v) {
+			u, err := url.Parse(o)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+				u.Path != "" || u.RawQuery != "" || u.User != nil {
+				return fmt.Errorf("CORS_ALLOWED_ORIGINS entry %q must be an origin such as https://app.example.com", o)
+			}
+			origins[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+		}
+		corsAllowedOrigins = origins
+	}
+	if v := os.Getenv("CORS_ALLOWED_METHODS"); v != "" {
+		methods := splitList(v)
+		for i, m := range methods {
+			m = strings.ToUpper(m)
+			if strings.ContainsAny(m, " \t") {
+				return fmt.Errorf("CORS_ALLOWED_METHODS has an invalid method %q", m)
+			}
+			methods[i] = m
+		}
+		if len(methods) == 0 {
+			return fmt.Errorf("CORS_ALLOWED_METHODS is empty")
+		}
+		corsAllowedMethods = methods
+	}
+	if v := os.Getenv("CORS_ALLOWED_HEADERS"); v != "" {
+		headers := splitList(v)
+		if len(headers) == 0 {
+			return fmt.Errorf("CORS_ALLOWED_HEADERS is empty")
+		}
+		corsAllowedHeaders = headers
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value, trimming blanks and dropping
+// empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// corsMiddleware wraps the whole router rather than being added with
+// r.Use, because mux answers an OPTIONS preflight for a POST-only route
+// with 405 before route middleware runs.
+func corsMiddleware(next http.Handler) http.Handler {
+	methods := strings.Join(corsAllowedMethods, ", ")
+	headers := strings.Join(corsAllowedHeaders, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		// Other origins get no CORS headers, so the browser withholds the
+		// response from them.
+		if origin := r.Header.Get("Origin"); corsAllowedOrigins[origin] {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
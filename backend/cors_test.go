@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func useAllowedOrigins(t *testing.T, origins ...string) {
+	prev := corsAllowedOrigins
+	corsAllowedOrigins = map[string]bool{}
+	for _, o := range origins {
+		corsAllowedOrigins[o] = true
+	}
+	t.Cleanup(func() { corsAllowedOrigins = prev })
+}
+
+func TestCORSOnlyEchoesAllowedOrigins(t *testing.T) {
+	useAllowedOrigins(t, "https://app.example.com")
+	handler := corsMiddleware(http.HandlerFunc(handleCSRFToken))
+
+	tests := []struct {
+		origin    string
+		wantAllow string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://evil.example", ""},
+		{"null", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{"GET", "OPTIONS"} {
+			r := httptest.NewRequest(method, "/api/auth/csrf", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("%s from %q: Allow-Origin = %q, want %q", method, tt.origin, got, tt.wantAllow)
+			}
+			wantCreds := ""
+			if tt.wantAllow != "" {
+				wantCreds = "true"
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != wantCreds {
+				t.Errorf("%s from %q: Allow-Credentials = %q, want %q", method, tt.origin, got, wantCreds)
+			}
+			if got := rec.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("%s from %q: Vary = %q, want Origin", method, tt.origin, got)
+			}
+		}
+	}
+}
+
+func TestLoadCORSAllowedOrigins(t *testing.T) {
+	useAllowedOrigins(t)
+	for _, v := range []string{"*", "app.example.com", "https://app.example.com/", "https://app.example.com/path", "ftp://app.example.com"} {
+		t.Setenv("CORS_ALLOWED_ORIGINS", v)
+		if err := loadCORSConfig(); err == nil {
+			t.Errorf("CORS_ALLOWED_ORIGINS=%s was accepted", v)
+		}
+	}
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://App.example.com, http://localhost:5173")
+	if err := loadCORSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if len(corsAllowedOrigins) != 2 || !corsAllowedOrigins["https://app.example.com"] || !corsAllowedOrigins["http://localhost:5173"] {
+		t.Errorf("corsAllowedOrigins = %v", corsAllowedOrigins)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Double-submit CSRF protection. Login sets a csrf_token cookie that page
+// scripts can read; every mutating request authenticated by the session
+// cookie must echo it in the X-CSRF-Token header. A cross-site form can make
+// the browser send the cookie but cannot read it to set the header.
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+func setCSRFCookie(w http.ResponseWriter) string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	token := hex.EncodeToString(b)
+	http.SetCookie(w, newCookie(csrfCookieName, token, int(sessionTTL.Seconds()), false))
+	return token
+}
+
+func clearCSRFCookie(w http.ResponseWriter) {
+	http.SetCookie(w, newCookie(csrfCookieName, "", -1, false))
+}
+
+// csrfToken returns the request's csrf_token cookie value, or "".
+func csrfToken(r *http.Request) string {
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// csrfTokenMatches reports whether token, taken from a header or form field,
+// equals the csrf_token cookie.
+func csrfTokenMatches(r *http.Request, token string) bool {
+	cookie := csrfToken(r)
+	return cookie != "" && token != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(token)) == 1
+}
+
+// startSession logs the user in: it sets the session cookie and a fresh
+// CSRF token.
+func startSession(w http.ResponseWriter, userID string) {
+	setSessionCookie(w, userID)
+	setCSRFCookie(w)
+}
+
+// csrfMiddleware rejects mutating requests whose X-CSRF-Token header does
+// not match the csrf_token cookie. Safe methods pass through and are given a
+// token if the session predates CSRF protection.
+func csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if csrfToken(r) == "" {
+				setCSRFCookie(w)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !csrfTokenMatches(r, r.Header.Get(csrfHeaderName)) {
+			writeError(w, r, http.StatusForbidden, "Missing or invalid CSRF token", "CSRF_INVALID")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCSRFToken returns the caller's CSRF token, issuing one if the request
+// has none, for clients that cannot read the cookie themselves. It needs no
+// session, so pages shown before login can fetch a token too.
+func handleCSRFToken(w http.ResponseWriter, r *http.Request) {
+	token := csrfToken(r)
+	if token == "" {
+		if token = setCSRFCookie(w); token == "" {
+			writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(map[string]string{"csrf_token": token}); err != nil {
+		slog.Error("Failed to encode CSRF token response", "err", err)
+	}
+}
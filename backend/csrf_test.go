@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		cookie        string
+		header        string
+		wantPass      bool
+		wantNewCookie bool
+	}{
+		{"get without a token is given one", "GET", "", "", true, true},
+		{"get with a token", "GET", "abc", "", true, false},
+		{"post with matching header", "POST", "abc", "abc", true, false},
+		{"delete with matching header", "DELETE", "abc", "abc", true, false},
+		{"post without header", "POST", "abc", "", false, false},
+		{"post with wrong header", "POST", "abc", "abd", false, false},
+		{"post without cookie", "POST", "", "abc", false, false},
+		{"post without either", "POST", "", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/account", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(csrfHeaderName, tt.header)
+			}
+			passed := false
+			rec := httptest.NewRecorder()
+			csrfMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+			})).ServeHTTP(rec, r)
+
+			if passed != tt.wantPass {
+				t.Errorf("passed = %v, want %v", passed, tt.wantPass)
+			}
+			if !tt.wantPass && (rec.Code != http.StatusForbidden || errorCode(t, rec) != "CSRF_INVALID") {
+				t.Errorf("status = %d, body %s; want 403 CSRF_INVALID", rec.Code, rec.Body)
+			}
+			issued := false
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == csrfCookieName && c.Value != "" {
+					issued = true
+					if c.HttpOnly {
+						t.Error("csrf_token cookie is HttpOnly; page scripts cannot read it")
+					}
+				}
+			}
+			if issued != tt.wantNewCookie {
+				t.Errorf("issued a token = %v, want %v", issued, tt.wantNewCookie)
+			}
+		})
+	}
+}
+
+func TestHandleCSRFToken(t *testing.T) {
+	decode := func(rec *httptest.ResponseRecorder) string {
+		t.Helper()
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", got)
+		}
+		return body["csrf_token"]
+	}
+
+	// Without a cookie, a token is issued and returned.
+	rec := httptest.NewRecorder()
+	handleCSRFToken(rec, httptest.NewRequest("GET", "/api/auth/csrf", nil))
+	token := decode(rec)
+	cookies := rec.Result().Cookies()
+	if len(token) != 64 || len(cookies) != 1 || cookies[0].Name != csrfCookieName || cookies[0].Value != token {
+		t.Fatalf("token %q, cookies %v", token, cookies)
+	}
+	if cookies[0].HttpOnly {
+		t.Error("csrf_token cookie is HttpOnly; page scripts must be able to read it")
+	}
+
+	// An existing token is echoed back and the cookie left alone.
+	r := httptest.NewRequest("GET", "/api/auth/csrf", nil)
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: token})
+	rec = httptest.NewRecorder()
+	handleCSRFToken(rec, r)
+	if got := decode(rec); got != token {
+		t.Errorf("token = %q, want the existing %q", got, token)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Errorf("existing token was replaced: %v", rec.Result().Cookies())
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Data export. GET /api/account/export returns everything kept about the
+// user as one JSON document: the profile, every game session and every
+// bankroll change. ?category=win,bonus narrows the bankroll changes to those
+// categories. Histories can be long, so rows are encoded as they are
+// read rather than collected first. All reads share one snapshot on the
+// primary, so the balance agrees with the transaction list and nothing
+// recent is missing.
+
+// BankrollChange is one bankroll_audit row.
+type BankrollChange struct {
+	ID                 int64     `json:"id"`
+	DeltaCents         int64     `json:"delta_cents"`
+	BalanceBeforeCents int64     `json:"balance_before_cents"`
+	BalanceAfterCents  int64     `json:"balance_after_cents"`
+	Reason             string    `json:"reason"`
+	Category           string    `json:"category"`
+	Note               *string   `json:"note,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+func handleAccountExport(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	categories := splitList(r.URL.Query().Get("category"))
+	for _, c := range categories {
+		if !slices.Contains(auditCategories, c) {
+			writeError(w, r, http.StatusBadRequest, "Unknown transaction category "+strconv.Quote(c), "INVALID_REQUEST")
+			return
+		}
+	}
+	ctx := r.Context()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		slog.Error("Failed to start account export", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	defer rollback(tx)
+
+	var user User
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, email, first_name, last_name, bankroll_cents, blackjack_wins, blackjack_losses, poker_wins, poker_losses, role, email_verified
+		FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.BankrollCents,
+		&user.BlackjackWins, &user.BlackjackLosses, &user.PokerWins, &user.PokerLosses, &user.Role, &user.EmailVerified)
+	if err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="account-export.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	// The status is sent with the first row, so a later failure can only cut
+	// the document short; the client then sees invalid JSON.
+	if err := streamAccountExport(ctx, tx, w, &user, categories); err != nil {
+		slog.Error("Failed to stream account export", "user_id", userID, "err", err)
+	}
+}
+
+// streamAccountExport writes the export document. A non-empty categories
+// limits the transactions to those categories.
+func streamAccountExport(ctx context.Context, tx *sql.Tx, w io.Writer, user *User, categories []string) error {
+	enc := json.NewEncoder(w)
+	if _, err := io.WriteString(w, `{"exported_at":`); err != nil {
+		return err
+	}
+	if err := enc.Encode(appClock.Now().UTC()); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"profile":`); err != nil {
+		return err
+	}
+	if err := enc.Encode(user); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `,"game_sessions":`); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+gameSessionColumns+`
+		FROM game_bets WHERE user_id = $1 ORDER BY created_at
+	`, user.ID)
+	if err != nil {
+		return err
+	}
+	err = encodeRows(w, enc, rows, func(rows *sql.Rows) (interface{}, error) {
+		return scanGameSession(rows)
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `,"transactions":`); err != nil {
+		return err
+	}
+	rows, err = tx.QueryContext(ctx, `
+		SELECT id, delta_cents, balance_before_cents, balance_after_cents, reason, category, note, created_at
+		FROM bankroll_audit
+		WHERE user_id = $1 AND (coalesce(cardinality($2::text[]), 0) = 0 OR category = ANY($2))
+		ORDER BY id
+	`, user.ID, pq.Array(categories))
+	if err != nil {
+		return err
+	}
+	err = encodeRows(w, enc, rows, func(rows *sql.Rows) (interface{}, error) {
+		var c BankrollChange
+		var note sql.NullString
+		err := rows.Scan(&c.ID, &c.DeltaCents, &c.BalanceBeforeCents, &c.BalanceAfterCents, &c.Reason, &c.Category, &note, &c.CreatedAt)
+		if note.Valid {
+			c.Note = &note.String
+		}
+		return c, err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+// encodeRows writes rows as a JSON array, encoding each row as it is scanned.
+// It closes rows.
+func encodeRows(w io.Writer, enc *json.Encoder, rows *sql.Rows, scan func(*sql.Rows) (interface{}, error)) error {
+	defer rows.Close()
+	sep := "["
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		sep = ","
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if sep == "[" {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestAccountExportRejectsUnknownCategory(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleAccountExport(rec, userRequest("GET", "/api/account/export?category=win,jackpot", "user-1", ""))
+
+	if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "INVALID_REQUEST" {
+		t.Errorf("status = %d, body %s; want 400 INVALID_REQUEST", rec.Code, rec.Body)
+	}
+}
+
+func TestAccountExportCategoryFilter(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+	if _, err := placeBet(userID, gameBlackjack, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := settleBet(userID, gameBlackjack, 1000, outcomeWon); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := correctBankroll(tx, userID, 500, "goodwill"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{categoryBet, categoryWin, categoryAdjustment}},
+		{"?category=win", []string{categoryWin}},
+		{"?category=win,%20adjustment", []string{categoryWin, categoryAdjustment}},
+		{"?category=bonus", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleAccountExport(rec, userRequest("GET", "/api/account/export"+tt.query, userID, ""))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			var doc struct {
+				GameSessions []GameSession    `json:"game_sessions"`
+				Transactions []BankrollChange `json:"transactions"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("export is not valid JSON: %v\n%s", err, rec.Body)
+			}
+			var got []string
+			for _, c := range doc.Transactions {
+				got = append(got, c.Category)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("categories = %v, want %v", got, tt.want)
+			}
+			// The filter applies to transactions only.
+			if len(doc.GameSessions) != 1 {
+				t.Errorf("game sessions = %d, want 1", len(doc.GameSessions))
+			}
+		})
+	}
+}
+
+func TestAccountExportOnlyIncludesOwnData(t *testing.T) {
+	openTestDB(t)
+	alice := createTestUser(t, 10000)
+	bob := createTestUser(t, 20000)
+	aliceBet, err := placeBet(alice, gameBlackjack, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := placeBet(bob, gamePoker, 2000); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleAccountExport(rec, userRequest("GET", "/api/account/export", alice, ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var doc struct {
+		Profile      User             `json:"profile"`
+		GameSessions []GameSession    `json:"game_sessions"`
+		Transactions []BankrollChange `json:"transactions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("export is not valid JSON: %v\n%s", err, rec.Body)
+	}
+	if doc.Profile.ID != alice || doc.Profile.BankrollCents != 9000 {
+		t.Errorf("profile = %+v, want alice with 9000", doc.Profile)
+	}
+	if len(doc.GameSessions) != 1 || doc.GameSessions[0].ID != aliceBet {
+		t.Errorf("game sessions = %+v, want only bet %s", doc.GameSessions, aliceBet)
+	}
+	if len(doc.Transactions) != 1 || doc.Transactions[0].DeltaCents != -1000 {
+		t.Errorf("transactions = %+v, want only alice's stake", doc.Transactions)
+	}
+}
+
+func TestAccountExportEmptyHistory(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+
+	rec := httptest.NewRecorder()
+	handleAccountExport(rec, userRequest("GET", "/api/account/export", userID, ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("export is not valid JSON: %v\n%s", err, rec.Body)
+	}
+	for _, key := range []string{"game_sessions", "transactions"} {
+		if string(doc[key]) != "[]" {
+			t.Errorf("%s = %s, want []", key, doc[key])
+		}
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="account-export.json"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Provably fair randomness for games played in the backend. Each user has
+// one pending server seed in fairness_seeds. Its SHA-256 hash is issued by
+// POST /api/games/seed before any bet, so the server is committed to it
+// before it sees the bet or the client seed. A bet consumes the pending seed
+// and the user's next nonce; the seed is stored on the bet and revealed once
+// it settles. Anyone can then recompute the outcome from the seed, the client
+// seed and the nonce, and check the seed against the hash they were given.
+
+const (
+	maxClientSeedLength = 64
+	fairnessAlgorithm   = "server_seed_hash = SHA-256(server_seed); outcome = first 8 bytes of HMAC-SHA256(key=server_seed, msg=client_seed:nonce) as big-endian uint64, mod n"
+	// legacyFairnessAlgorithm describes bets drawn before seeds were issued
+	// ahead of the bet, which have no nonce.
+	legacyFairnessAlgorithm = "server_seed_hash = SHA-256(server_seed); outcome = first 8 bytes of HMAC-SHA256(key=server_seed, msg=client_seed:bet_id) as big-endian uint64, mod n"
+)
+
+var (
+	errNoServerSeed = conflict("SEED_NOT_ISSUED", "Request a server seed hash from POST /api/games/seed before betting")
+	errSeedMismatch = conflict("SEED_MISMATCH", "server_seed_hash does not match your pending server seed")
+)
+
+type fairRNG struct {
+	seed       string
+	clientSeed string
+	nonce      int64
+}
+
+// SeedResponse is the commitment to the caller's next server seed.
+type SeedResponse struct {
+	ServerSeedHash string `json:"server_seed_hash"`
+	Nonce          int64  `json:"nonce"`
+}
+
+type FairnessResponse struct {
+	BetID          string  `json:"bet_id"`
+	Game           string  `json:"game"`
+	Status         string  `json:"status"`
+	ServerSeedHash string  `json:"server_seed_hash"`
+	ServerSeed     *string `json:"server_seed"`
+	ClientSeed     string  `json:"client_seed"`
+	Nonce          *int64  `json:"nonce"`
+	Algorithm      string  `json:"algorithm"`
+	// PayoutRatio and HouseEdgePercent are the current payout terms for a
+	// win in this game.
+	PayoutRatio      string  `json:"payout_ratio"`
+	HouseEdgePercent float64 `json:"house_edge_percent"`
+}
+
+func newServerSeed() (string, error) {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(seed), nil
+}
+
+func seedHash(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *fairRNG) ServerSeed() string {
+	return f.seed
+}
+
+func (f *fairRNG) ServerSeedHash() string {
+	return seedHash(f.seed)
+}
+
+// Intn returns the outcome in [0, n) for the bet. For the small n used by
+// our games the modulo bias is negligible (and zero for powers of two).
+func (f *fairRNG) Intn(n int) int {
+	mac := hmac.New(sha256.New, []byte(f.seed))
+	mac.Write([]byte(f.clientSeed + ":" + strconv.FormatInt(f.nonce, 10)))
+	return int(binary.BigEndian.Uint64(mac.Sum(nil)[:8]) % uint64(n))
+}
+
+// issueServerSeed returns the hash of the user's pending server seed and
+// the nonce it will be used with, generating the seed if none is pending.
+// Asking again before betting returns the same commitment.
+func issueServerSeed(userID string) (SeedResponse, error) {
+	candidate, err := newServerSeed()
+	if err != nil {
+		return SeedResponse{}, err
+	}
+	var seed string
+	var nonce int64
+	err = db.QueryRow(`
+		INSERT INTO fairness_seeds (user_id, server_seed) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+			SET server_seed = coalesce(fairness_seeds.server_seed, EXCLUDED.server_seed)
+		RETURNING server_seed, next_nonce
+	`, userID, candidate).Scan(&seed, &nonce)
+	if err != nil {
+		return SeedResponse{}, err
+	}
+	return SeedResponse{ServerSeedHash: seedHash(seed), Nonce: nonce}, nil
+}
+
+// takeServerSeed consumes the user's pending server seed and nonce for a
+// bet. If wantHash is set it must match the pending seed, so a client can be
+// sure the seed it was shown is the one used; on a mismatch nothing is
+// consumed.
+func takeServerSeed(userID, clientSeed, wantHash string) (*fairRNG, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	var seed sql.NullString
+	var nonce int64
+	err = tx.QueryRow(`
+		SELECT server_seed, next_nonce FROM fairness_seeds WHERE user_id = $1 FOR UPDATE
+	`, userID).Scan(&seed, &nonce)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !seed.Valid) {
+		return nil, errNoServerSeed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if wantHash != "" && wantHash != seedHash(seed.String) {
+		return nil, errSeedMismatch
+	}
+	if _, err := tx.Exec(`
+		UPDATE fairness_seeds SET server_seed = NULL, next_nonce = next_nonce + 1 WHERE user_id = $1
+	`, userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &fairRNG{seed: seed.String, clientSeed: clientSeed, nonce: nonce}, nil
+}
+
+// commitServerSeed stores the seed hash, client seed and nonce for a bet
+// before its outcome is drawn.
+func commitServerSeed(betID string, f *fairRNG) error {
+	_, err := db.Exec(`
+		UPDATE game_bets SET server_seed_hash = $1, client_seed = $2, nonce = $3 WHERE id = $4
+	`, f.ServerSeedHash(), f.clientSeed, f.nonce, betID)
+	return err
+}
+
+// revealServerSeed stores the seed once the bet has settled.
+func revealServerSeed(betID string, f *fairRNG) error {
+	_, err := db.Exec("UPDATE game_bets SET server_seed = $1 WHERE id = $2 AND status <> 'active'", f.ServerSeed(), betID)
+	return err
+}
+
+// handleIssueSeed commits the server to the caller's next server seed by
+// returning its hash.
+func handleIssueSeed(w http.ResponseWriter, r *http.Request) {
+	resp, err := issueServerSeed(r.Header.Get("X-User-ID"))
+	if err != nil {
+		slog.Error("Failed to issue server seed", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode seed response", "err", err)
+	}
+}
+
+// handleFairness returns the commit/reveal pair for one of the caller's
+// bets. The seed is withheld while the bet is still active.
+func handleFairness(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	betID := mux.Vars(r)["sessionId"]
+	if !uuidPattern.MatchString(betID) {
+		writeError(w, r, http.StatusBadRequest, "Invalid session ID", "INVALID_REQUEST")
+		return
+	}
+
+	resp := FairnessResponse{BetID: betID, Algorithm: fairnessAlgorithm}
+	var hash, seed, clientSeed sql.NullString
+	var nonce sql.NullInt64
+	err := db.QueryRow(`
+		SELECT game, status, server_seed_hash, server_seed, client_seed, nonce
+		FROM game_bets WHERE id = $1 AND user_id = $2
+	`, betID, userID).Scan(&resp.Game, &resp.Status, &hash, &seed, &clientSeed, &nonce)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !hash.Valid) {
+		writeError(w, r, http.StatusNotFound, "No fairness record for this session", "NOT_FOUND")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load fairness record", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	resp.ServerSeedHash = hash.String
+	ratio := payoutTable[resp.Game][outcomeWon]
+	resp.PayoutRatio = big.NewRat(ratio.Num, ratio.Den).RatString()
+	resp.HouseEdgePercent, _ = houseEdgePercent(resp.Game)
+	resp.ClientSeed = clientSeed.String
+	if nonce.Valid {
+		resp.Nonce = &nonce.Int64
+	} else {
+		resp.Algorithm = legacyFairnessAlgorithm
+	}
+	if seed.Valid && resp.Status != "active" {
+		resp.ServerSeed = &seed.String
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode fairness response", "err", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestFairRNGIntnMatchesPublishedAlgorithm(t *testing.T) {
+	rng := &fairRNG{seed: "5eed", clientSeed: "lucky", nonce: 7}
+	mac := hmac.New(sha256.New, []byte("5eed"))
+	mac.Write([]byte("lucky:7"))
+	want := int(binary.BigEndian.Uint64(mac.Sum(nil)[:8]) % 1000)
+
+	if got := rng.Intn(1000); got != want {
+		t.Errorf("Intn = %d, want %d", got, want)
+	}
+	sum := sha256.Sum256([]byte("5eed"))
+	if got := rng.ServerSeedHash(); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("ServerSeedHash = %s", got)
+	}
+}
+
+func issueSeed(t *testing.T, userID string) SeedResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleIssueSeed(rec, userRequest("POST", "/api/games/seed", userID, ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("issue seed: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp SeedResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestIssueSeedIsStableUntilUsed(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+
+	first := issueSeed(t, userID)
+	if again := issueSeed(t, userID); again != first {
+		t.Errorf("second issue = %+v, want %+v", again, first)
+	}
+	if first.Nonce != 0 {
+		t.Errorf("first nonce = %d, want 0", first.Nonce)
+	}
+}
+
+func TestCoinflipRequiresIssuedSeed(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+
+	rec := httptest.NewRecorder()
+	handleCoinflip(rec, userRequest("POST", "/api/games/coinflip", userID, `{"bet":100,"call":"heads"}`))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := userBankroll(t, userID); got != 10000 {
+		t.Errorf("bankroll = %d, want the bet refunded", got)
+	}
+}
+
+func TestCoinflipRejectsMismatchedSeedHash(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+	issued := issueSeed(t, userID)
+
+	rec := httptest.NewRecorder()
+	handleCoinflip(rec, userRequest("POST", "/api/games/coinflip", userID,
+		`{"bet":100,"call":"heads","server_seed_hash":"00"}`))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := userBankroll(t, userID); got != 10000 {
+		t.Errorf("bankroll = %d, want the bet refunded", got)
+	}
+	// The pending seed was not consumed.
+	if again := issueSeed(t, userID); again != issued {
+		t.Errorf("pending seed changed to %+v", again)
+	}
+}
+
+func TestCoinflipUsesIssuedSeed(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+	issued := issueSeed(t, userID)
+
+	rec := httptest.NewRecorder()
+	handleCoinflip(rec, userRequest("POST", "/api/games/coinflip", userID,
+		`{"bet":100,"call":"heads","client_seed":"mine","server_seed_hash":"`+issued.ServerSeedHash+`"}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var flip CoinflipResponse
+	if err := json.NewDecoder(rec.Body).Decode(&flip); err != nil {
+		t.Fatal(err)
+	}
+	if flip.ServerSeedHash != issued.ServerSeedHash || flip.Nonce != issued.Nonce {
+		t.Errorf("flip used %s/%d, want the issued %s/%d", flip.ServerSeedHash, flip.Nonce, issued.ServerSeedHash, issued.Nonce)
+	}
+	if flip.NextServerSeedHash == "" || flip.NextServerSeedHash == issued.ServerSeedHash {
+		t.Errorf("next_server_seed_hash = %q", flip.NextServerSeedHash)
+	}
+	if next := issueSeed(t, userID); next.ServerSeedHash != flip.NextServerSeedHash || next.Nonce != 1 {
+		t.Errorf("next seed = %+v", next)
+	}
+
+	req := userRequest("GET", "/api/games/"+flip.BetID+"/fairness", userID, "")
+	req = mux.SetURLVars(req, map[string]string{"sessionId": flip.BetID})
+	rec = httptest.NewRecorder()
+	handleFairness(rec, req)
+	var fair FairnessResponse
+	if err := json.NewDecoder(rec.Body).Decode(&fair); err != nil {
+		t.Fatal(err)
+	}
+	if fair.ServerSeed == nil || fair.Nonce == nil {
+		t.Fatalf("fairness record not revealed: %+v", fair)
+	}
+	rng := &fairRNG{seed: *fair.ServerSeed, clientSeed: fair.ClientSeed, nonce: *fair.Nonce}
+	if rng.ServerSeedHash() != issued.ServerSeedHash {
+		t.Errorf("revealed seed does not hash to the issued hash")
+	}
+	want := "heads"
+	if rng.Intn(2) == 1 {
+		want = "tails"
+	}
+	if flip.Result != want {
+		t.Errorf("result = %s, recomputed %s", flip.Result, want)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// All calls to the blackjack and poker services go through doGameRequest,
+// which caps how many can be in flight at once. When the cap is reached,
+// requests are refused straight away with GAME_BUSY rather than queued, so a
+// burst of players cannot pile up connections on a struggling game service.
+
+const defaultGameMaxInFlight = 100
+
+// gameClientTimeout bounds a whole game service call, including reading the
+// reply, so a hung service cannot hold an in-flight slot for good.
+const gameClientTimeout = 30 * time.Second
+
+var errGameBusy = errors.New("game service busy")
+
+var (
+	gameClient = &http.Client{Timeout: gameClientTimeout}
+	// gameSlots holds one token per in-flight call; nil means unlimited.
+	gameSlots = make(chan struct{}, defaultGameMaxInFlight)
+)
+
+func loadGameClientConfig() error {
+	v := os.Getenv("GAME_MAX_IN_FLIGHT")
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return fmt.Errorf("GAME_MAX_IN_FLIGHT must be a non-negative integer, got %q", v)
+	}
+	if n == 0 {
+		gameSlots = nil
+	} else {
+		gameSlots = make(chan struct{}, n)
+	}
+	return nil
+}
+
+// doGameRequest sends req to a game service. The in-flight slot it takes is
+// released when the response body is closed, or immediately if the call
+// fails. It returns errGameBusy without sending anything if no slot is free.
+func doGameRequest(req *http.Request) (*http.Response, error) {
+	if gameSlots == nil {
+		return gameClient.Do(req)
+	}
+	select {
+	case gameSlots <- struct{}{}:
+	default:
+		return nil, errGameBusy
+	}
+	resp, err := gameClient.Do(req)
+	if err != nil {
+		<-gameSlots
+		return nil, err
+	}
+	resp.Body = &slotBody{ReadCloser: resp.Body, slots: gameSlots}
+	return resp, nil
+}
+
+// slotBody returns its in-flight slot the first time it is closed.
+type slotBody struct {
+	io.ReadCloser
+	slots chan struct{}
+	once  sync.Once
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { <-b.slots })
+	return err
+}
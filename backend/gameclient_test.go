@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func useGameSlots(t *testing.T, n int) {
+	prev := gameSlots
+	gameSlots = make(chan struct{}, n)
+	t.Cleanup(func() { gameSlots = prev })
+}
+
+func newGameRequest(t *testing.T, url string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestDoGameRequestRefusesWhenFull(t *testing.T) {
+	useGameSlots(t, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	first, err := doGameRequest(newGameRequest(t, upstream.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doGameRequest(newGameRequest(t, upstream.URL)); !errors.Is(err, errGameBusy) {
+		t.Fatalf("second call err = %v, want errGameBusy", err)
+	}
+
+	// Closing twice must hand back only the one slot it took.
+	first.Body.Close()
+	first.Body.Close()
+	if len(gameSlots) != 0 {
+		t.Fatalf("%d slots still held after close", len(gameSlots))
+	}
+	resp, err := doGameRequest(newGameRequest(t, upstream.URL))
+	if err != nil {
+		t.Fatalf("call after release: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func TestDoGameRequestReleasesSlotOnFailure(t *testing.T) {
+	useGameSlots(t, 1)
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	url := upstream.URL
+	upstream.Close()
+
+	if _, err := doGameRequest(newGameRequest(t, url)); err == nil || errors.Is(err, errGameBusy) {
+		t.Fatalf("err = %v, want a connection error", err)
+	}
+	if len(gameSlots) != 0 {
+		t.Errorf("%d slots still held after a failed call", len(gameSlots))
+	}
+}
+
+func TestLoadGameClientConfig(t *testing.T) {
+	useGameSlots(t, defaultGameMaxInFlight)
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", defaultGameMaxInFlight, false},
+		{"25", 25, false},
+		{"0", -1, false},
+		{"-1", 0, true},
+		{"lots", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			gameSlots = make(chan struct{}, defaultGameMaxInFlight)
+			t.Setenv("GAME_MAX_IN_FLIGHT", tt.value)
+			err := loadGameClientConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.want < 0 {
+				if gameSlots != nil {
+					t.Errorf("cap = %d, want unlimited", cap(gameSlots))
+				}
+			} else if cap(gameSlots) != tt.want {
+				t.Errorf("cap = %d, want %d", cap(gameSlots), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteGameUnavailableBusy(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeGameUnavailable(rec, httptest.NewRequest("POST", "/api/blackjack/start", nil), errGameBusy, true)
+
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != "GAME_BUSY" {
+		t.Errorf("status = %d, body %s; want 503 GAME_BUSY", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+}
+
+func TestDoGameRequestReleasesSlotWhenServiceHangs(t *testing.T) {
+	useGameSlots(t, 1)
+	prev := gameClient
+	gameClient = &http.Client{Timeout: 50 * time.Millisecond}
+	t.Cleanup(func() { gameClient = prev })
+
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	if _, err := doGameRequest(newGameRequest(t, upstream.URL)); err == nil {
+		t.Fatal("call to a hung service succeeded")
+	}
+	if len(gameSlots) != 0 {
+		t.Errorf("%d slots still held after the call timed out", len(gameSlots))
+	}
+}
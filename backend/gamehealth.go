@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// The health prober polls each game service so a hand is not started, and a
+// bet not taken, while the service behind it is down. A service is marked
+// disabled after one failed probe and enabled again after one success;
+// starts are refused in between with GAME_UNAVAILABLE. Services count as
+// enabled until the first probe says otherwise.
+
+var errGameDisabled = errors.New("game service failed its health check")
+
+var (
+	gameHealthInterval = 15 * time.Second
+	gameHealthPath     = "/"
+	gameHealthClient   = &http.Client{Timeout: 2 * time.Second}
+)
+
+// loadGameHealthConfig reads GAME_HEALTH_INTERVAL and GAME_HEALTH_PATH. An
+// interval of 0 turns probing off, leaving every game enabled.
+func loadGameHealthConfig() error {
+	if v := os.Getenv("GAME_HEALTH_INTERVAL"); v == "0" {
+		gameHealthInterval = 0
+	} else {
+		d, err := envDuration("GAME_HEALTH_INTERVAL", gameHealthInterval)
+		if err != nil {
+			return err
+		}
+		gameHealthInterval = d
+	}
+	if v := os.Getenv("GAME_HEALTH_PATH"); v != "" {
+		if !strings.HasPrefix(v, "/") {
+			return fmt.Errorf("GAME_HEALTH_PATH must start with /, got %q", v)
+		}
+		gameHealthPath = v
+	}
+	return nil
+}
+
+// runGameHealthProbes probes the game services every gameHealthInterval
+// until ctx is done.
+func runGameHealthProbes(ctx context.Context, services ...*httpGameService) {
+	if gameHealthInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(gameHealthInterval)
+	defer ticker.Stop()
+	for {
+		for _, svc := range services {
+			probeGameService(ctx, svc)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeGameService checks one service and records the result, logging only
+// when its state changes. Probes bypass doGameRequest so they neither take
+// nor wait for an in-flight slot.
+func probeGameService(ctx context.Context, svc *httpGameService) {
+	err := checkGameService(ctx, svc)
+	if ctx.Err() != nil {
+		return
+	}
+	wasDown := svc.down.Swap(err != nil)
+	switch {
+	case err != nil && !wasDown:
+		slog.Warn("Game service unhealthy; disabling", "service", svc.name, "err", err)
+	case err == nil && wasDown:
+		slog.Info("Game service healthy again; enabling", "service", svc.name)
+	}
+}
+
+func checkGameService(ctx context.Context, svc *httpGameService) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, svc.baseURL+gameHealthPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := gameHealthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbeGameService(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	var path atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path.Store(r.URL.Path)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer upstream.Close()
+	svc := &httpGameService{name: "test", baseURL: upstream.URL}
+	ctx := context.Background()
+
+	steps := []struct {
+		status      int
+		wantEnabled bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusServiceUnavailable, false},
+		{http.StatusServiceUnavailable, false},
+		{http.StatusNoContent, true},
+		{http.StatusFound, false},
+	}
+	for i, step := range steps {
+		status.Store(int32(step.status))
+		probeGameService(ctx, svc)
+		if svc.Enabled() != step.wantEnabled {
+			t.Errorf("step %d (%d): Enabled = %v, want %v", i, step.status, svc.Enabled(), step.wantEnabled)
+		}
+	}
+	if got := path.Load(); got != gameHealthPath {
+		t.Errorf("probed %v, want %s", got, gameHealthPath)
+	}
+
+	upstream.Close()
+	svc.down.Store(false)
+	probeGameService(ctx, svc)
+	if svc.Enabled() {
+		t.Error("unreachable service is still enabled")
+	}
+}
+
+func TestProbeGameServiceIgnoresShutdown(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+	svc := &httpGameService{name: "test", baseURL: upstream.URL}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	probeGameService(ctx, svc)
+	if !svc.Enabled() {
+		t.Error("a probe cut short by shutdown disabled the service")
+	}
+}
+
+func TestLoadGameHealthConfig(t *testing.T) {
+	prevInterval, prevPath := gameHealthInterval, gameHealthPath
+	t.Cleanup(func() { gameHealthInterval, gameHealthPath = prevInterval, prevPath })
+	tests := []struct {
+		interval, path string
+		wantInterval   time.Duration
+		wantPath       string
+		wantErr        bool
+	}{
+		{"", "", 15 * time.Second, "/", false},
+		{"0", "", 0, "/", false},
+		{"30s", "/healthz", 30 * time.Second, "/healthz", false},
+		{"soon", "", 0, "", true},
+		{"", "healthz", 0, "", true},
+	}
+	for _, tt := range tests {
+		gameHealthInterval, gameHealthPath = 15*time.Second, "/"
+		t.Setenv("GAME_HEALTH_INTERVAL", tt.interval)
+		t.Setenv("GAME_HEALTH_PATH", tt.path)
+		err := loadGameHealthConfig()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q/%q: err = %v, wantErr %v", tt.interval, tt.path, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (gameHealthInterval != tt.wantInterval || gameHealthPath != tt.wantPath) {
+			t.Errorf("%q/%q: got %v %q, want %v %q", tt.interval, tt.path, gameHealthInterval, gameHealthPath, tt.wantInterval, tt.wantPath)
+		}
+	}
+}
+
+func TestStartRefusedWhileServiceDown(t *testing.T) {
+	blackjack := useFakeBlackjack(t)
+	blackjack.disabled = true
+
+	rec := httptest.NewRecorder()
+	handleBlackjackStart(rec, userRequest("POST", "/api/blackjack/start", "user-1", `{"bet":100}`))
+
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != "GAME_UNAVAILABLE" {
+		t.Fatalf("status = %d, body %s; want 503 GAME_UNAVAILABLE", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "15" {
+		t.Errorf("Retry-After = %q, want the probe interval", got)
+	}
+	if len(blackjack.sent) != 0 {
+		t.Errorf("requests reached the disabled service: %v", blackjack.sent)
+	}
+}
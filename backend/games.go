@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Client layer for the game services. Handlers reach the blackjack and poker
+// APIs only through the gameService interface, so a fake can stand in for
+// them.
+
+var errUnknownGameAction = errors.New("unknown game action")
+
+// gameService is the client for one game backend.
+type gameService interface {
+	// Start deals a new hand. body is the service's start request.
+	Start(ctx context.Context, userID string, body []byte) (*gameReply, error)
+	// Act sends an in-hand action, such as "hit" or "flop", with an
+	// optional JSON body.
+	Act(ctx context.Context, userID, action string, body []byte) (*gameReply, error)
+	// State fetches the user's current hand.
+	State(ctx context.Context, userID string) (*gameReply, error)
+	// Enabled reports whether new hands may be started.
+	Enabled() bool
+}
+
+// gameReply is a game service's raw response.
+type gameReply struct {
+	StatusCode int
+	Body       []byte
+}
+
+// state decodes the reply as a JSON object. A body that is not one gives an
+// empty map, so lookups simply miss.
+func (g *gameReply) state() map[string]interface{} {
+	var state map[string]interface{}
+	if err := json.Unmarshal(g.Body, &state); err != nil {
+		slog.Error("Failed to unmarshal game service response", "status", g.StatusCode, "err", err)
+	}
+	return state
+}
+
+// httpGameService talks to a game service over HTTP.
+type httpGameService struct {
+	name        string
+	baseURL     string
+	startPath   string
+	statePath   string
+	actionPaths map[string]string
+	// down is set while the service is failing health probes.
+	down atomic.Bool
+}
+
+func (s *httpGameService) Enabled() bool {
+	return !s.down.Load()
+}
+
+func (s *httpGameService) Start(ctx context.Context, userID string, body []byte) (*gameReply, error) {
+	return s.call(ctx, userID, http.MethodPost, s.startPath, body)
+}
+
+func (s *httpGameService) Act(ctx context.Context, userID, action string, body []byte) (*gameReply, error) {
+	path, ok := s.actionPaths[action]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownGameAction, action)
+	}
+	return s.call(ctx, userID, http.MethodPost, path, body)
+}
+
+func (s *httpGameService) State(ctx context.Context, userID string) (*gameReply, error) {
+	return s.call(ctx, userID, http.MethodGet, s.statePath, nil)
+}
+
+// gameCallTimeout bounds each game service call, since call detaches from
+// the request's cancellation. Set by GAME_CALL_TIMEOUT.
+var gameCallTimeout = 10 * time.Second
+
+// call sends one request and reads the whole reply. It is not cancelled when
+// the client goes away: the service may already have acted on the hand, and
+// the result still has to be settled. It gives up after gameCallTimeout.
+func (s *httpGameService) call(ctx context.Context, userID, method, path string, body []byte) (*gameReply, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), gameCallTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(callCtx, method, s.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-User-ID", userID)
+	setTraceHeaders(ctx, req)
+	resp, err := doGameRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &gameReply{StatusCode: resp.StatusCode, Body: data}, nil
+}
+
+var (
+	blackjackHTTP = &httpGameService{
+		name:      gameBlackjack,
+		baseURL:   "http://blackjack-api:8000",
+		startPath: "/blackjack/start",
+		statePath: "/blackjack/state",
+		actionPaths: map[string]string{
+			"hit":       "/blackjack/hit",
+			"stand":     "/blackjack/stand",
+			"surrender": "/blackjack/surrender",
+			"insurance": "/blackjack/insurance",
+		},
+	}
+	pokerHTTP = &httpGameService{
+		name:      gamePoker,
+		baseURL:   "http://poker-api:8001",
+		startPath: "/texas/single/start",
+		statePath: "/texas/state",
+		actionPaths: map[string]string{
+			"action":   "/texas/single/action",
+			"bet":      "/texas/single/bet",
+			"flop":     "/texas/flop",
+			"turn":     "/texas/turn",
+			"river":    "/texas/river",
+			"showdown": "/texas/showdown",
+		},
+	}
+
+	blackjackService gameService = blackjackHTTP
+	pokerService     gameService = pokerHTTP
+)
+
+// loadGameServiceConfig points the game clients at BLACKJACK_API_URL and
+// POKER_API_URL, keeping the Docker service names as defaults. A URL that is
+// not http(s) with a host fails startup rather than every game request.
+func loadGameServiceConfig() error {
+	for _, c := range []struct {
+		name string
+		svc  *httpGameService
+	}{
+		{"BLACKJACK_API_URL", blackjackHTTP},
+		{"POKER_API_URL", pokerHTTP},
+	} {
+		v := os.Getenv(c.name)
+		if v == "" {
+			continue
+		}
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL with a host, got %q", c.name, v)
+		}
+		c.svc.baseURL = strings.TrimSuffix(v, "/")
+	}
+	return nil
+}
+
+// proxyGameAction forwards the request body to a game action and relays the
+// service's reply.
+func proxyGameAction(svc gameService, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		reply, err := svc.Act(r.Context(), r.Header.Get("X-User-ID"), action, body)
+		if err != nil {
+			writeGameUnavailable(w, r, err, false)
+			return
+		}
+		writeGameReply(w, reply.Body)
+	}
+}
+
+// proxyGameState relays the user's current hand.
+func proxyGameState(svc gameService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reply, err := svc.State(r.Context(), r.Header.Get("X-User-ID"))
+		if err != nil {
+			writeGameUnavailable(w, r, err, false)
+			return
+		}
+		writeGameReply(w, reply.Body)
+	}
+}
+
+// relayGameReply passes on the service's reply with its status code, so a
+// refused action reaches the client as an error.
+func relayGameReply(w http.ResponseWriter, reply *gameReply) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reply.StatusCode)
+	if _, err := w.Write(reply.Body); err != nil {
+		slog.Error("Failed to write game service response", "err", err)
+	}
+}
+
+func writeGameReply(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		slog.Error("Failed to write game service response", "err", err)
+	}
+}
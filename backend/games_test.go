@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGameCallOutlivesClientButNotTimeout(t *testing.T) {
+	prev := gameCallTimeout
+	gameCallTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { gameCallTimeout = prev })
+
+	delay := make(chan time.Duration, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(<-delay):
+			w.Write([]byte(`{}`))
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	svc := &httpGameService{name: "test", baseURL: upstream.URL, statePath: "/state"}
+
+	// A client that has gone away does not cancel the call.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	delay <- 10 * time.Millisecond
+	if _, err := svc.State(ctx, "user-1"); err != nil {
+		t.Errorf("call after the client left: %v", err)
+	}
+
+	// A service slower than gameCallTimeout does.
+	delay <- time.Minute
+	start := time.Now()
+	_, err := svc.State(context.Background(), "user-1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow service: err = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("call took %v", elapsed)
+	}
+}
+
+func TestGameActionsRejectOversizedBody(t *testing.T) {
+	poker := useFakePoker(t)
+	body := `{"action":"call","pad":"` + strings.Repeat("x", maxRequestBodyBytes) + `"}`
+	handlers := map[string]http.HandlerFunc{
+		"proxy":  proxyGameAction(pokerService, "bet"),
+		"action": handlePokerAction,
+	}
+	for name, h := range handlers {
+		rec := httptest.NewRecorder()
+		h(rec, userRequest("POST", "/api/poker/"+name, "user-1", body))
+		if rec.Code != http.StatusRequestEntityTooLarge || errorCode(t, rec) != "REQUEST_TOO_LARGE" {
+			t.Errorf("%s: status = %d, body %s; want 413 REQUEST_TOO_LARGE", name, rec.Code, rec.Body)
+		}
+	}
+	if len(poker.sent) != 0 {
+		t.Errorf("oversized bodies reached the service: %d requests", len(poker.sent))
+	}
+}
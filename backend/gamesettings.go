@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Per-game settings that admins change at runtime through
+// PATCH /api/admin/games/{game}, stored in game_settings. A game without a
+// row is enabled with no bet range beyond its own rules. placeBet reads the
+// row inside the bet transaction, so a change applies from the next bet;
+// hands already started play out and settle as usual.
+
+var errGameSuspended = errors.New("game is disabled")
+
+// betRangeError rejects a bet outside the game's configured range. Either
+// bound may be unset.
+type betRangeError struct {
+	min, max sql.NullInt64
+}
+
+func (e betRangeError) Error() string {
+	return "bet must be " + e.bounds()
+}
+
+// bounds describes the range, e.g. "between 100 and 5000 cents".
+func (e betRangeError) bounds() string {
+	switch {
+	case e.min.Valid && e.max.Valid:
+		return fmt.Sprintf("between %d and %d cents", e.min.Int64, e.max.Int64)
+	case e.min.Valid:
+		return fmt.Sprintf("at least %d cents", e.min.Int64)
+	default:
+		return fmt.Sprintf("at most %d cents", e.max.Int64)
+	}
+}
+
+// GameSettings is a game's admin-managed configuration.
+type GameSettings struct {
+	Game        string     `json:"game"`
+	Enabled     bool       `json:"enabled"`
+	MinBetCents *int64     `json:"min_bet_cents"`
+	MaxBetCents *int64     `json:"max_bet_cents"`
+	Description string     `json:"description"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+// UpdateGameSettingsRequest changes only the fields it sets. A bet bound of
+// 0 removes that bound.
+type UpdateGameSettingsRequest struct {
+	Enabled     *bool   `json:"enabled"`
+	MinBetCents *int64  `json:"min_bet_cents"`
+	MaxBetCents *int64  `json:"max_bet_cents"`
+	Description *string `json:"description"`
+}
+
+// checkGameSettings returns errGameSuspended or a betRangeError if game's
+// settings rule out bet.
+func checkGameSettings(tx *sql.Tx, game string, bet int64) error {
+	enabled, rng, err := gameBetRange(tx, game)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return errGameSuspended
+	}
+	if (rng.min.Valid && bet < rng.min.Int64) || (rng.max.Valid && bet > rng.max.Int64) {
+		return rng
+	}
+	return nil
+}
+
+// gameBetRange reads whether game takes bets and its configured range. A game
+// without settings is enabled with neither bound set.
+func gameBetRange(tx *sql.Tx, game string) (bool, betRangeError, error) {
+	enabled := true
+	var rng betRangeError
+	err := tx.QueryRow(`
+		SELECT enabled, min_bet_cents, max_bet_cents FROM game_settings WHERE game = $1
+	`, game).Scan(&enabled, &rng.min, &rng.max)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return enabled, rng, err
+}
+
+func handleAdminUpdateGame(w http.ResponseWriter, r *http.Request) {
+	game := mux.Vars(r)["game"]
+	if _, ok := gameAccounts[game]; !ok {
+		writeError(w, r, http.StatusNotFound, "Game not found", "NOT_FOUND")
+		return
+	}
+	var req UpdateGameSettingsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if (req.MinBetCents != nil && *req.MinBetCents < 0) || (req.MaxBetCents != nil && *req.MaxBetCents < 0) {
+		writeError(w, r, http.StatusBadRequest, "Bet limits cannot be negative", "INVALID_REQUEST")
+		return
+	}
+	if req.Description != nil && len(*req.Description) > maxAdminNoteLength {
+		writeError(w, r, http.StatusBadRequest, "Description must be at most 500 characters", "INVALID_REQUEST")
+		return
+	}
+
+	settings, err := updateGameSettings(game, req)
+	var rngErr betRangeError
+	switch {
+	case errors.As(err, &rngErr):
+		writeError(w, r, http.StatusBadRequest, "min_bet_cents must not exceed max_bet_cents", "INVALID_REQUEST")
+		return
+	case err != nil:
+		slog.Error("Failed to update game settings", "game", game, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	slog.Info("Admin updated game settings", "game", game, "enabled", settings.Enabled,
+		"min_bet_cents", settings.MinBetCents, "max_bet_cents", settings.MaxBetCents)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		slog.Error("Failed to encode game settings response", "err", err)
+	}
+}
+
+// updateGameSettings applies req to game's row, creating it with the
+// defaults first if needed. It returns a betRangeError if the resulting
+// minimum would exceed the maximum.
+func updateGameSettings(game string, req UpdateGameSettingsRequest) (GameSettings, error) {
+	s := GameSettings{Game: game}
+	tx, err := db.Begin()
+	if err != nil {
+		return s, err
+	}
+	defer rollback(tx)
+
+	if _, err := tx.Exec("INSERT INTO game_settings (game) VALUES ($1) ON CONFLICT (game) DO NOTHING", game); err != nil {
+		return s, err
+	}
+	var min, max sql.NullInt64
+	if err := tx.QueryRow(`
+		SELECT enabled, min_bet_cents, max_bet_cents, description FROM game_settings WHERE game = $1 FOR UPDATE
+	`, game).Scan(&s.Enabled, &min, &max, &s.Description); err != nil {
+		return s, err
+	}
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+	if req.MinBetCents != nil {
+		min = sql.NullInt64{Int64: *req.MinBetCents, Valid: *req.MinBetCents > 0}
+	}
+	if req.MaxBetCents != nil {
+		max = sql.NullInt64{Int64: *req.MaxBetCents, Valid: *req.MaxBetCents > 0}
+	}
+	if req.Description != nil {
+		s.Description = *req.Description
+	}
+	if min.Valid && max.Valid && min.Int64 > max.Int64 {
+		return s, betRangeError{min: min, max: max}
+	}
+
+	var updatedAt time.Time
+	if err := tx.QueryRow(`
+		UPDATE game_settings
+		SET enabled = $1, min_bet_cents = $2, max_bet_cents = $3, description = $4, updated_at = now()
+		WHERE game = $5
+		RETURNING updated_at
+	`, s.Enabled, min, max, s.Description, game).Scan(&updatedAt); err != nil {
+		return s, err
+	}
+	if min.Valid {
+		s.MinBetCents = &min.Int64
+	}
+	if max.Valid {
+		s.MaxBetCents = &max.Int64
+	}
+	s.UpdatedAt = &updatedAt
+	return s, tx.Commit()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBetRangeErrorBounds(t *testing.T) {
+	set := func(v int64) sql.NullInt64 { return sql.NullInt64{Int64: v, Valid: true} }
+	tests := []struct {
+		err  betRangeError
+		want string
+	}{
+		{betRangeError{min: set(100), max: set(5000)}, "between 100 and 5000 cents"},
+		{betRangeError{min: set(100)}, "at least 100 cents"},
+		{betRangeError{max: set(5000)}, "at most 5000 cents"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.bounds(); got != tt.want {
+			t.Errorf("bounds = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// patchGame sends PATCH /api/admin/games/{game} with body.
+func patchGame(t *testing.T, game, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := userRequest("PATCH", "/api/admin/games/"+game, "admin-1", body)
+	req = mux.SetURLVars(req, map[string]string{"game": game})
+	rec := httptest.NewRecorder()
+	handleAdminUpdateGame(rec, req)
+	return rec
+}
+
+func TestAdminUpdateGameRejectsBadInput(t *testing.T) {
+	if rec := patchGame(t, "roulette", `{"enabled":false}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown game: status = %d, want 404", rec.Code)
+	}
+	if rec := patchGame(t, gameBlackjack, `{"min_bet_cents":-1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative bound: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdminUpdateGame(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 100000)
+
+	rec := patchGame(t, gameBlackjack, `{"min_bet_cents":100,"max_bet_cents":500}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var settings GameSettings
+	if err := json.Unmarshal(rec.Body.Bytes(), &settings); err != nil {
+		t.Fatal(err)
+	}
+	if !settings.Enabled || settings.MinBetCents == nil || *settings.MinBetCents != 100 || settings.MaxBetCents == nil || *settings.MaxBetCents != 500 {
+		t.Fatalf("settings = %+v", settings)
+	}
+
+	for _, bet := range []int64{50, 600} {
+		_, err := placeBet(userID, gameBlackjack, bet)
+		var rngErr betRangeError
+		if !errors.As(err, &rngErr) {
+			t.Fatalf("bet %d: err = %v, want betRangeError", bet, err)
+		}
+		if apiErr := betAPIError(err); apiErr == nil || apiErr.Code != "BET_OUT_OF_RANGE" {
+			t.Errorf("bet %d: betAPIError = %+v", bet, apiErr)
+		}
+	}
+	// Other games are not affected.
+	if _, err := placeBet(userID, gamePoker, 100); err != nil {
+		t.Errorf("poker bet: %v", err)
+	}
+
+	// Only the fields sent change; a bound of 0 removes it.
+	if rec := patchGame(t, gameBlackjack, `{"description":"High rollers","min_bet_cents":0}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if _, err := placeBet(userID, gameBlackjack, 50); err != nil {
+		t.Fatalf("bet under the removed minimum: %v", err)
+	}
+	if _, err := settleBet(userID, gameBlackjack, 50, outcomeLost); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := placeBet(userID, gameBlackjack, 600); !errors.As(err, new(betRangeError)) {
+		t.Errorf("bet over the kept maximum: err = %v", err)
+	}
+
+	if rec := patchGame(t, gameBlackjack, `{"min_bet_cents":1000}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("min over max: status = %d, want 400", rec.Code)
+	}
+
+	if rec := patchGame(t, gameBlackjack, `{"enabled":false}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	_, err := placeBet(userID, gameBlackjack, 200)
+	if !errors.Is(err, errGameSuspended) {
+		t.Fatalf("disabled game: err = %v, want errGameSuspended", err)
+	}
+	if apiErr := betAPIError(err); apiErr == nil || apiErr.Status != http.StatusForbidden || apiErr.Code != "GAME_DISABLED" {
+		t.Errorf("betAPIError = %+v, want 403 GAME_DISABLED", apiErr)
+	}
+}
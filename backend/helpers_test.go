@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Tests that touch the database run against the PostgreSQL named by
+// TEST_DATABASE_URL and are skipped when it is unset. Each such test drops
+// and rebuilds the public schema from database/schema.sql, so point it at a
+// throwaway database, never a real one.
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := os.ReadFile("../database/schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("DROP SCHEMA IF EXISTS public CASCADE; CREATE SCHEMA public"); err != nil {
+		t.Fatalf("reset schema: %v", err)
+	}
+	if _, err := conn.Exec(string(schema)); err != nil {
+		t.Fatalf("apply schema.sql: %v", err)
+	}
+	prevDB, prevReadDB := db, readDB
+	db, readDB = conn, conn
+	t.Cleanup(func() {
+		db, readDB = prevDB, prevReadDB
+		conn.Close()
+	})
+}
+
+var testUserSeq int
+
+// createTestUser inserts a verified player holding bankroll cents and
+// returns their ID.
+func createTestUser(t *testing.T, bankroll int64) string {
+	t.Helper()
+	testUserSeq++
+	var id string
+	err := db.QueryRow(`
+		INSERT INTO users (email, password_hash, first_name, last_name, bankroll_cents, email_verified)
+		VALUES ($1, 'x', 'Test', 'Player', $2, true) RETURNING id
+	`, fmt.Sprintf("player%d@example.com", testUserSeq), bankroll).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// setTestPassword gives userID the password, hashed at bcrypt's minimum
+// cost to keep tests fast.
+func setTestPassword(t *testing.T, userID, password string) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", hash, userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func userBankroll(t *testing.T, userID string) int64 {
+	t.Helper()
+	var bankroll int64
+	if err := db.QueryRow("SELECT bankroll_cents FROM users WHERE id = $1", userID).Scan(&bankroll); err != nil {
+		t.Fatal(err)
+	}
+	return bankroll
+}
+
+func betStatus(t *testing.T, betID string) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow("SELECT status FROM game_bets WHERE id = $1", betID).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+// userRequest builds a request as authMiddleware would pass it on for userID.
+func userRequest(method, path, userID, body string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-User-ID", userID)
+	return r
+}
+
+// fakeGameService answers with canned replies, keyed by "start", "state" or
+// the action name, and records the bodies it was sent.
+type fakeGameService struct {
+	mu       sync.Mutex
+	replies  map[string]*gameReply
+	sent     map[string]string
+	disabled bool
+}
+
+func newFakeGameService() *fakeGameService {
+	return &fakeGameService{replies: map[string]*gameReply{}, sent: map[string]string{}}
+}
+
+// reply sets the JSON body returned for key with status 200.
+func (f *fakeGameService) reply(key, body string) {
+	f.replies[key] = &gameReply{StatusCode: http.StatusOK, Body: []byte(body)}
+}
+
+func (f *fakeGameService) answer(key string, body []byte) (*gameReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent[key] = string(body)
+	if reply, ok := f.replies[key]; ok {
+		return reply, nil
+	}
+	return nil, fmt.Errorf("fake game service has no reply for %q", key)
+}
+
+func (f *fakeGameService) Start(_ context.Context, _ string, body []byte) (*gameReply, error) {
+	return f.answer("start", body)
+}
+
+func (f *fakeGameService) Act(_ context.Context, _, action string, body []byte) (*gameReply, error) {
+	return f.answer(action, body)
+}
+
+func (f *fakeGameService) State(context.Context, string) (*gameReply, error) {
+	return f.answer("state", nil)
+}
+
+func (f *fakeGameService) Enabled() bool {
+	return !f.disabled
+}
+
+// useFakePoker swaps in a fake poker service for the test.
+func useFakePoker(t *testing.T) *fakeGameService {
+	fake := newFakeGameService()
+	prev := pokerService
+	pokerService = fake
+	t.Cleanup(func() { pokerService = prev })
+	return fake
+}
+
+// useFakeBlackjack swaps in a fake blackjack service for the test.
+func useFakeBlackjack(t *testing.T) *fakeGameService {
+	fake := newFakeGameService()
+	prev := blackjackService
+	blackjackService = fake
+	t.Cleanup(func() { blackjackService = prev })
+	return fake
+}
+
+// fixedClock always reports the same time.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+// useClock sets appClock to now for the test.
+func useClock(t *testing.T, now time.Time) {
+	prev := appClock
+	appClock = fixedClock{now: now}
+	t.Cleanup(func() { appClock = prev })
+}
+
+// sessionCookie returns a session cookie for userID issued at issuedAt,
+// signed with a test secret if none is configured.
+func sessionCookie(t *testing.T, userID string, issuedAt time.Time) *http.Cookie {
+	t.Helper()
+	if len(jwtSecret) == 0 {
+		jwtSecret = []byte("test-secret")
+		t.Cleanup(func() { jwtSecret = nil })
+	}
+	prev := appClock
+	appClock = fixedClock{now: issuedAt}
+	defer func() { appClock = prev }()
+	rec := httptest.NewRecorder()
+	setSessionCookie(rec, userID)
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			return c
+		}
+	}
+	t.Fatal("setSessionCookie set no session cookie")
+	return nil
+}
+
+// useIdleTimeout sets sessionIdleTimeout for the test.
+func useIdleTimeout(t *testing.T, d time.Duration) {
+	prev := sessionIdleTimeout
+	sessionIdleTimeout = d
+	t.Cleanup(func() { sessionIdleTimeout = prev })
+}
+
+// errorCode returns the code of a JSON error response.
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error response %q: %v", rec.Body, err)
+	}
+	return resp.Code
+}
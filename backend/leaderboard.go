@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Leaderboard of the richest players. Only a first name and last initial are
+// shown; self-excluded and empty accounts are left out.
+
+const (
+	defaultLeaderboardSize = 10
+	maxLeaderboardSize     = 100
+	leaderboardCacheTTL    = 30 * time.Second
+)
+
+type LeaderboardEntry struct {
+	Rank          int    `json:"rank"`
+	DisplayName   string `json:"display_name"`
+	BankrollCents int64  `json:"bankroll_cents"`
+}
+
+// leaderboardCache holds the top maxLeaderboardSize rows so every requested
+// size can be served from one query.
+var leaderboardCache struct {
+	sync.Mutex
+	entries   []LeaderboardEntry
+	fetchedAt time.Time
+}
+
+func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLeaderboardSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxLeaderboardSize {
+			writeError(w, r, http.StatusBadRequest, "limit must be between 1 and 100", "INVALID_REQUEST")
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), reportQueryTimeout)
+	defer cancel()
+	entries, err := topBankrolls(ctx)
+	if err != nil {
+		writeQueryError(w, r, err, "Failed to load leaderboard")
+		return
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]LeaderboardEntry{"leaders": entries}); err != nil {
+		slog.Error("Failed to encode leaderboard response", "err", err)
+	}
+}
+
+func topBankrolls(ctx context.Context) ([]LeaderboardEntry, error) {
+	leaderboardCache.Lock()
+	defer leaderboardCache.Unlock()
+	if leaderboardCache.entries != nil && time.Since(leaderboardCache.fetchedAt) < leaderboardCacheTTL {
+		return leaderboardCache.entries, nil
+	}
+
+	rows, err := readDB.QueryContext(ctx, `
+		SELECT first_name, last_name, bankroll_cents FROM users
+		WHERE bankroll_cents > 0 AND (self_excluded_until IS NULL OR self_excluded_until <= now())
+		ORDER BY bankroll_cents DESC, created_at
+		LIMIT $1
+	`, maxLeaderboardSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []LeaderboardEntry{}
+	for rows.Next() {
+		var first, last string
+		var e LeaderboardEntry
+		if err := rows.Scan(&first, &last, &e.BankrollCents); err != nil {
+			return nil, err
+		}
+		e.Rank = len(entries) + 1
+		e.DisplayName = leaderboardName(first, last)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	leaderboardCache.entries = entries
+	leaderboardCache.fetchedAt = time.Now()
+	return entries, nil
+}
+
+// leaderboardName renders "Jane D." so full names are never published.
+func leaderboardName(first, last string) string {
+	initial, _ := utf8.DecodeRuneInString(last)
+	if initial == utf8.RuneError {
+		return first
+	}
+	return first + " " + string(initial) + "."
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Responsible-gambling controls: a per-period loss limit, self-exclusion and
+// an optional cap on any single bet as a fraction of the bankroll.
+
+const maxSelfExclusionDays = 3650
+
+var (
+	errInsufficientFunds = errors.New("insufficient funds")
+	errLossLimitReached  = errors.New("loss limit reached")
+	errSelfExcluded      = errors.New("account is self-excluded")
+	errEmailNotVerified  = errors.New("email not verified")
+	errBetOverFraction   = errors.New("bet exceeds the allowed fraction of bankroll")
+)
+
+// maxBetFractionPPM caps a single stake at this many millionths of the
+// bankroll held when it is placed; one million, the default, is no cap.
+// Fixed-point keeps the boundary exact: with a fraction of 0.25 a 2500-cent
+// bet from 10000 is allowed and 2501 is not.
+var maxBetFractionPPM int64 = 1_000_000
+
+func loadBetFractionConfig() error {
+	v := os.Getenv("MAX_BET_FRACTION")
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 || f > 1 {
+		return fmt.Errorf("MAX_BET_FRACTION must be a fraction in (0, 1], got %q", v)
+	}
+	maxBetFractionPPM = int64(math.Round(f * 1_000_000))
+	return nil
+}
+
+// maxBetFor returns the largest stake allowed from bankroll. It is computed
+// in two parts so large balances cannot overflow.
+func maxBetFor(bankroll int64) int64 {
+	return bankroll/1_000_000*maxBetFractionPPM + bankroll%1_000_000*maxBetFractionPPM/1_000_000
+}
+
+type LimitsRequest struct {
+	LossLimitCents int64  `json:"loss_limit_cents"`
+	Period         string `json:"period"`
+}
+
+type LimitsResponse struct {
+	LossLimitCents    *int64     `json:"loss_limit_cents"`
+	Period            *string    `json:"period"`
+	PeriodLossCents   int64      `json:"period_loss_cents"`
+	SelfExcludedUntil *time.Time `json:"self_excluded_until"`
+}
+
+type SelfExcludeRequest struct {
+	Days int `json:"days"`
+}
+
+func limitPeriodLength(period string) (time.Duration, bool) {
+	switch period {
+	case "daily":
+		return 24 * time.Hour, true
+	case "weekly":
+		return 7 * 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// betLockTimeout bounds how long placing a bet waits for row locks held by
+// another request for the same user, so contention fails fast with
+// TRY_AGAIN instead of holding the request until the server's write
+// timeout. Set by BET_LOCK_TIMEOUT. Settlement does not use it: the game
+// service has already finished the hand, so waiting beats failing.
+var betLockTimeout = 5 * time.Second
+
+// setLockTimeout applies betLockTimeout to tx.
+func setLockTimeout(tx *sql.Tx) error {
+	_, err := tx.Exec(fmt.Sprintf("SET LOCAL lock_timeout = %d", betLockTimeout.Milliseconds()))
+	return err
+}
+
+// isLockTimeout reports whether err is a lock_not_available (SQLSTATE
+// 55P03), which lock_timeout raises.
+func isLockTimeout(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "55P03"
+}
+
+// placeBet deducts bet from the user's bankroll and records it as the
+// active bet for game, refusing unverified or self-excluded users and bets
+// that would take the user past their loss limit for the period. It returns
+// the new bet's ID.
+func placeBet(userID, game string, bet int64) (string, error) {
+	acct, ok := gameAccounts[game]
+	if !ok {
+		return "", errUnknownGame
+	}
+	if inc := betIncrement(game); bet%inc != 0 {
+		return "", betIncrementError{increment: inc}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer rollback(tx)
+
+	if err := setLockTimeout(tx); err != nil {
+		return "", err
+	}
+	if err := checkGameSettings(tx, game, bet); err != nil {
+		return "", err
+	}
+	if err := checkStake(tx, userID, bet); err != nil {
+		return "", err
+	}
+	balance, err := adjustBankroll(tx, userID, -bet, acct.BetReason)
+	if err != nil {
+		return "", err
+	}
+	// Refuse a bet whose best outcome could not be paid under the cap, so
+	// settlement never fails on it.
+	if exceedsBankrollCap(balance + maxPayout(game, bet)) {
+		return "", errBankrollCapReached
+	}
+	betID, err := recordBet(tx, userID, game, bet)
+	if err != nil {
+		return "", err
+	}
+	return betID, tx.Commit()
+}
+
+// checkStake locks the user's row inside tx and checks that they may stake
+// amount: they must be verified, not self-excluded, within their loss limit
+// and able to cover it without going over MAX_BET_FRACTION of their bankroll.
+func checkStake(tx *sql.Tx, userID string, amount int64) error {
+	var bankroll, periodLoss int64
+	var lossLimit sql.NullInt64
+	var period sql.NullString
+	var periodStart time.Time
+	var excludedUntil sql.NullTime
+	var verified bool
+	err := tx.QueryRow(`
+		SELECT bankroll_cents, loss_limit_cents, loss_limit_period, period_loss_cents, period_started_at, self_excluded_until, email_verified
+		FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(&bankroll, &lossLimit, &period, &periodLoss, &periodStart, &excludedUntil, &verified)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return errEmailNotVerified
+	}
+
+	now := appClock.Now()
+	if excludedUntil.Valid && now.Before(excludedUntil.Time) {
+		return errSelfExcluded
+	}
+	if length, ok := limitPeriodLength(period.String); ok && now.Sub(periodStart) >= length {
+		periodLoss = 0
+		if _, err := tx.Exec("UPDATE users SET period_loss_cents = 0, period_started_at = $1 WHERE id = $2", now, userID); err != nil {
+			return err
+		}
+	}
+	if lossLimit.Valid && periodLoss+amount > lossLimit.Int64 {
+		return errLossLimitReached
+	}
+	if bankroll < amount {
+		return errInsufficientFunds
+	}
+	if amount > maxBetFor(bankroll) {
+		return errBetOverFraction
+	}
+	return nil
+}
+
+// writeBetError maps a placeBet failure to an HTTP response.
+func writeBetError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	apiErr := betAPIError(err)
+	if apiErr == nil {
+		slog.Error("Failed to place bet", "err", err)
+		apiErr = errInternal
+	}
+	writeAPIError(w, r, apiErr)
+}
+
+// betAPIError maps a bet placement error to its response, or returns nil for
+// an unexpected one.
+func betAPIError(err error) *APIError {
+	var incErr betIncrementError
+	var rngErr betRangeError
+	switch {
+	case errors.As(err, &incErr):
+		return badRequest("BET_INVALID_INCREMENT", fmt.Sprintf("Bets must be in multiples of %d cents", incErr.increment))
+	case errors.As(err, &rngErr):
+		return badRequest("BET_OUT_OF_RANGE", "Bets on this game must be "+rngErr.bounds())
+	case errors.Is(err, errGameSuspended):
+		return forbidden("GAME_DISABLED", "This game is currently disabled")
+	case errors.Is(err, errSelfExcluded):
+		return forbidden("SELF_EXCLUDED", "Account is self-excluded")
+	case errors.Is(err, errEmailNotVerified):
+		return forbidden("EMAIL_NOT_VERIFIED", "Verify your email address before playing")
+	case errors.Is(err, errLossLimitReached):
+		return forbidden("LOSS_LIMIT_REACHED", "Bet would exceed your loss limit for this period")
+	case errors.Is(err, errInsufficientFunds):
+		return badRequest("INSUFFICIENT_FUNDS", "Insufficient funds")
+	case errors.Is(err, errBetOverFraction):
+		return forbidden("BET_EXCEEDS_FRACTION", fmt.Sprintf("A single bet may be at most %s%% of your bankroll",
+			strconv.FormatFloat(float64(maxBetFractionPPM)/10_000, 'f', -1, 64)))
+	case errors.Is(err, errBankrollCapReached):
+		return conflict("BANKROLL_CAP_REACHED", "A win on this bet would take your bankroll over the maximum")
+	case errors.Is(err, errTooManyGames):
+		return conflict("TOO_MANY_SESSIONS", fmt.Sprintf("You can have at most %d games in progress", maxActiveGames))
+	case errors.Is(err, errGameInProgress):
+		return conflict("GAME_IN_PROGRESS", "Finish your current hand before starting another")
+	case isLockTimeout(err):
+		return unavailable("TRY_AGAIN", "Another request is updating your account; try again", time.Second)
+	}
+	return nil
+}
+
+func handleGetLimits(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	var resp LimitsResponse
+	var lossLimit sql.NullInt64
+	var period sql.NullString
+	var excludedUntil sql.NullTime
+	err := db.QueryRow(`
+		SELECT loss_limit_cents, loss_limit_period, period_loss_cents, self_excluded_until
+		FROM users WHERE id = $1
+	`, userID).Scan(&lossLimit, &period, &resp.PeriodLossCents, &excludedUntil)
+	if err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	if lossLimit.Valid {
+		resp.LossLimitCents = &lossLimit.Int64
+	}
+	if period.Valid {
+		resp.Period = &period.String
+	}
+	if excludedUntil.Valid {
+		resp.SelfExcludedUntil = &excludedUntil.Time
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode limits response", "err", err)
+	}
+}
+
+// handleSetLimits sets or (with loss_limit_cents 0) clears the loss limit.
+// The running period total is kept so a limit cannot be reset by re-saving it.
+func handleSetLimits(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	var req LimitsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.LossLimitCents < 0 {
+		writeError(w, r, http.StatusBadRequest, "Loss limit cannot be negative", "INVALID_LIMIT")
+		return
+	}
+
+	var err error
+	if req.LossLimitCents == 0 {
+		_, err = db.Exec("UPDATE users SET loss_limit_cents = NULL, loss_limit_period = NULL WHERE id = $1", userID)
+	} else {
+		if _, ok := limitPeriodLength(req.Period); !ok {
+			writeError(w, r, http.StatusBadRequest, "Period must be daily or weekly", "INVALID_LIMIT")
+			return
+		}
+		_, err = db.Exec("UPDATE users SET loss_limit_cents = $1, loss_limit_period = $2 WHERE id = $3", req.LossLimitCents, req.Period, userID)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	handleGetLimits(w, r)
+}
+
+// handleSelfExclude blocks the user from logging in and playing for the given
+// number of days and ends their current session. An existing exclusion is
+// never shortened.
+func handleSelfExclude(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	var req SelfExcludeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Days < 1 || req.Days > maxSelfExclusionDays {
+		writeError(w, r, http.StatusBadRequest, "Days must be between 1 and 3650", "INVALID_EXCLUSION")
+		return
+	}
+	var until time.Time
+	err := db.QueryRow(`
+		UPDATE users SET self_excluded_until = GREATEST(COALESCE(self_excluded_until, now()), now() + make_interval(days => $1))
+		WHERE id = $2
+		RETURNING self_excluded_until
+	`, req.Days, userID).Scan(&until)
+	if err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	slog.Info("User self-excluded", "user_id", userID, "until", until.Format(time.RFC3339))
+	notifyWebhook(eventUserSelfExcluded, map[string]interface{}{"user_id": userID, "until": until})
+	clearSessionCookie(w)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]time.Time{"self_excluded_until": until}); err != nil {
+		slog.Error("Failed to encode self-exclusion response", "err", err)
+	}
+}
+
+// selfExcludedUntil reports whether the user is currently self-excluded.
+func selfExcludedUntil(userID string) (time.Time, bool) {
+	var until sql.NullTime
+	if err := db.QueryRow("SELECT self_excluded_until FROM users WHERE id = $1", userID).Scan(&until); err != nil {
+		return time.Time{}, false
+	}
+	if until.Valid && appClock.Now().Before(until.Time) {
+		return until.Time, true
+	}
+	return time.Time{}, false
+}
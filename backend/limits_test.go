@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// useBetFraction sets maxBetFractionPPM for the test.
+func useBetFraction(t *testing.T, ppm int64) {
+	prev := maxBetFractionPPM
+	maxBetFractionPPM = ppm
+	t.Cleanup(func() { maxBetFractionPPM = prev })
+}
+
+func TestMaxBetFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		ppm      int64
+		bankroll int64
+		want     int64
+	}{
+		{"no cap", 1_000_000, 12345, 12345},
+		{"quarter", 250_000, 10000, 2500},
+		{"quarter rounds down", 250_000, 10003, 2500},
+		{"just reaches one cent", 250_000, 4, 1},
+		{"below one cent", 250_000, 3, 0},
+		{"empty bankroll", 250_000, 0, 0},
+		{"tiny fraction of a large bankroll", 1, 1_000_000_000, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useBetFraction(t, tt.ppm)
+			if got := maxBetFor(tt.bankroll); got != tt.want {
+				t.Errorf("maxBetFor(%d) = %d, want %d", tt.bankroll, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxBetForDoesNotOverflow(t *testing.T) {
+	useBetFraction(t, 999_999)
+	want := new(big.Int).Mul(big.NewInt(math.MaxInt64), big.NewInt(999_999))
+	want.Quo(want, big.NewInt(1_000_000))
+	// The two-part computation may round each part down separately, so it
+	// can fall at most one cent short of the exact floor.
+	got := maxBetFor(math.MaxInt64)
+	if diff := new(big.Int).Sub(want, big.NewInt(got)); diff.Sign() < 0 || diff.Cmp(big.NewInt(1)) > 0 {
+		t.Errorf("maxBetFor(MaxInt64) = %d, want about %s", got, want)
+	}
+}
+
+func TestLoadBetFractionConfig(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantPPM int64
+		wantErr bool
+	}{
+		{"0.25", 250_000, false},
+		{"1", 1_000_000, false},
+		{"0.0000015", 2, false},
+		{"0", 0, true},
+		{"1.5", 0, true},
+		{"-0.1", 0, true},
+		{"quarter", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			useBetFraction(t, 1_000_000)
+			t.Setenv("MAX_BET_FRACTION", tt.value)
+			err := loadBetFractionConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && maxBetFractionPPM != tt.wantPPM {
+				t.Errorf("maxBetFractionPPM = %d, want %d", maxBetFractionPPM, tt.wantPPM)
+			}
+		})
+	}
+}
+
+func TestPlaceBetAtFractionBoundary(t *testing.T) {
+	openTestDB(t)
+	useBetFraction(t, 250_000)
+	userID := createTestUser(t, 10000)
+
+	if _, err := placeBet(userID, gameBlackjack, 2501); !errors.Is(err, errBetOverFraction) {
+		t.Errorf("bet of 2501 err = %v, want errBetOverFraction", err)
+	}
+	if _, err := placeBet(userID, gameBlackjack, 2500); err != nil {
+		t.Errorf("bet of 2500: %v", err)
+	}
+}
+
+func TestLockTimeoutMapsToTryAgain(t *testing.T) {
+	lockErr := fmt.Errorf("place bet: %w", &pq.Error{Code: "55P03"})
+	if !isLockTimeout(lockErr) {
+		t.Error("55P03 is not a lock timeout")
+	}
+	if isLockTimeout(&pq.Error{Code: "57014"}) || isLockTimeout(errors.New("55P03")) {
+		t.Error("other errors count as a lock timeout")
+	}
+	apiErr := betAPIError(lockErr)
+	if apiErr == nil || apiErr.Status != http.StatusServiceUnavailable || apiErr.Code != "TRY_AGAIN" || apiErr.RetryAfter != time.Second {
+		t.Errorf("betAPIError = %+v, want 503 TRY_AGAIN retrying after 1s", apiErr)
+	}
+}
+
+func TestPlaceBetFailsFastWhenUserLocked(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+	prev := betLockTimeout
+	betLockTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { betLockTimeout = prev })
+
+	holder, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Rollback()
+	if _, err := holder.Exec("SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = placeBet(userID, gameBlackjack, 100)
+	if !isLockTimeout(err) {
+		t.Fatalf("err = %v, want a lock timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("placeBet waited %v", elapsed)
+	}
+	holder.Rollback()
+	if got := userBankroll(t, userID); got != 10000 {
+		t.Errorf("bankroll = %d, want 10000", got)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// newLogger builds the application logger. level is debug, info, warn or
+// error and format is text or json; empty values mean info and text.
+// Tests can pass a bytes.Buffer as w to assert on output.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "", "info":
+		lvl = slog.LevelInfo
+	case "warn", "warning":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		return nil, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("LOG_FORMAT must be text or json, got %q", format)
+}
+
+// fatal logs at error level and exits, like log.Fatal.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// requestLogEntry describes one completed request.
+type requestLogEntry struct {
+	RequestID  string
+	TraceID    string
+	Method     string
+	Path       string
+	Status     int
+	DurationMS float64
+	Bytes      int
+	RemoteIP   string
+	UserID     string
+}
+
+// requestLogger receives one entry per completed request.
+type requestLogger interface {
+	LogRequest(entry requestLogEntry)
+}
+
+// slogRequestLogger writes each entry as an info-level "request" record, so
+// access logs follow LOG_FORMAT like everything else.
+type slogRequestLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogRequestLogger) LogRequest(entry requestLogEntry) {
+	l.logger.LogAttrs(context.Background(), slog.LevelInfo, "request",
+		slog.String("request_id", entry.RequestID),
+		slog.String("trace_id", entry.TraceID),
+		slog.String("method", entry.Method),
+		slog.String("path", entry.Path),
+		slog.Int("status", entry.Status),
+		slog.Float64("duration_ms", entry.DurationMS),
+		slog.Int("bytes", entry.Bytes),
+		slog.String("remote_ip", entry.RemoteIP),
+		slog.String("user_id", entry.UserID),
+	)
+}
+
+// statusRecorder captures the status code and body size written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// requestIDMiddleware tags each request with an ID, reusing a caller-supplied
+// X-Request-ID when present, and echoes it in the response. It also attaches
+// the request's trace context; see tracing.go.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, traceKey, traceFromRequest(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// loggingMiddleware emits one structured entry per request. X-User-ID is
+// stripped from the incoming request so only authMiddleware can set it.
+func loggingMiddleware(logger requestLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r.Header.Del("X-User-ID")
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			tc, _ := traceFromContext(r.Context())
+			logger.LogRequest(requestLogEntry{
+				RequestID:  requestIDFromContext(r.Context()),
+				TraceID:    tc.TraceID,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     rec.status,
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+				Bytes:      rec.bytes,
+				RemoteIP:   remoteIP(r),
+				UserID:     r.Header.Get("X-User-ID"),
+			})
+		})
+	}
+}
+
+// trustedProxies are the peers whose X-Real-IP header is believed. The
+// default covers the nginx proxy running alongside the backend; set
+// TRUSTED_PROXIES (comma-separated IPs or CIDRs) when it runs elsewhere.
+var trustedProxies = mustParseCIDRs("127.0.0.0/8", "::1/128")
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+func loadTrustedProxyConfig() error {
+	v, ok := os.LookupEnv("TRUSTED_PROXIES")
+	if !ok {
+		return nil
+	}
+	var nets []*net.IPNet
+	for _, entry := range splitList(v) {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("TRUSTED_PROXIES entry %q must be an IP address or CIDR", entry)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// remoteIP returns the client's address: the X-Real-IP header when the
+// request came through a trusted proxy, and the peer address otherwise, so
+// a client connecting directly cannot pick its own address.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if real := r.Header.Get("X-Real-IP"); real != "" && isTrustedProxy(host) {
+		return real
+	}
+	return host
+}
+
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverMiddleware turns a handler panic into the standard JSON 500 and logs
+// it with the request ID and stack. http.ErrAbortHandler is re-raised, since
+// it asks the server to abort the response.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			slog.Error("Handler panicked", "request_id", requestIDFromContext(r.Context()),
+				"panic", fmt.Sprint(rec), "stack", string(debug.Stack()))
+			writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	handler := requestIDMiddleware(recoverMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})))
+	r := httptest.NewRequest("GET", "/api/user/me", nil)
+	r.Header.Set("X-Request-ID", "req-7")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body %q: %v", rec.Body, err)
+	}
+	if rec.Code != http.StatusInternalServerError || resp.Code != "INTERNAL_ERROR" || resp.RequestID != "req-7" {
+		t.Errorf("status = %d, body %s; want 500 INTERNAL_ERROR for req-7", rec.Code, rec.Body)
+	}
+	if out := logs.String(); !strings.Contains(out, `"panic":"boom"`) || !strings.Contains(out, "recoverMiddleware") {
+		t.Errorf("panic not logged with its stack: %s", out)
+	}
+}
+
+func TestRecoverMiddlewareRepanicsAbort(t *testing.T) {
+	handler := recoverMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", rec)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	t.Error("ErrAbortHandler was swallowed")
+}
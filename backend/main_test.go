@@ -0,0 +1,1096 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+func TestPokerOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		winners []interface{}
+		want    string
+	}{
+		{"player alone", []interface{}{"Player"}, outcomeWon},
+		{"cpu alone", []interface{}{"CPU 1"}, outcomeLost},
+		{"split with a cpu", []interface{}{"CPU 2", "Player"}, outcomePush},
+		{"split between cpus", []interface{}{"CPU 1", "CPU 2"}, outcomeLost},
+		{"no winners", nil, outcomeLost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := map[string]interface{}{"status": "finished", "winners": tt.winners}
+			if got := pokerOutcome(state); got != tt.want {
+				t.Errorf("pokerOutcome = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPokerActionSettlesWhenCPUsFold(t *testing.T) {
+	openTestDB(t)
+	poker := useFakePoker(t)
+	userID := createTestUser(t, 10000)
+	betID, err := placeBet(userID, gamePoker, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poker.reply("action", `{"status":"finished","winners":["Player"],"bet":10}`)
+
+	rec := httptest.NewRecorder()
+	handlePokerAction(rec, userRequest("POST", "/api/poker/action", userID, `{"action":"stay"}`))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := betStatus(t, betID); got != outcomeWon {
+		t.Errorf("bet status = %q, want won", got)
+	}
+	if got, want := userBankroll(t, userID), 9000+payoutFor(gamePoker, outcomeWon, 1000); got != want {
+		t.Errorf("bankroll = %d, want %d", got, want)
+	}
+}
+
+func TestPokerActionFoldSettlesLoss(t *testing.T) {
+	openTestDB(t)
+	poker := useFakePoker(t)
+	userID := createTestUser(t, 10000)
+	betID, err := placeBet(userID, gamePoker, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poker.reply("action", `{"status":"finished","winners":["CPU 1"],"bet":10}`)
+
+	rec := httptest.NewRecorder()
+	handlePokerAction(rec, userRequest("POST", "/api/poker/action", userID, `{"action":"fold"}`))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := poker.sent["action"]; got != `{"action":"fold"}` {
+		t.Errorf("sent %q to the poker service", got)
+	}
+	if got := betStatus(t, betID); got != outcomeLost {
+		t.Errorf("bet status = %q, want lost", got)
+	}
+	if got := userBankroll(t, userID); got != 9000 {
+		t.Errorf("bankroll = %d, want 9000", got)
+	}
+	// The settled hand no longer blocks the next one.
+	if _, err := placeBet(userID, gamePoker, 1000); err != nil {
+		t.Errorf("next bet: %v", err)
+	}
+}
+
+func TestPokerActionLeavesUnfinishedHandActive(t *testing.T) {
+	openTestDB(t)
+	poker := useFakePoker(t)
+	userID := createTestUser(t, 10000)
+	betID, err := placeBet(userID, gamePoker, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poker.reply("action", `{"status":"flop","winners":null,"bet":10}`)
+
+	rec := httptest.NewRecorder()
+	handlePokerAction(rec, userRequest("POST", "/api/poker/action", userID, `{"action":"stay"}`))
+
+	if got := betStatus(t, betID); got != "active" {
+		t.Errorf("bet status = %q, want active", got)
+	}
+	if _, err := placeBet(userID, gamePoker, 1000); !errors.Is(err, errGameInProgress) {
+		t.Errorf("second bet err = %v, want errGameInProgress", err)
+	}
+}
+
+func TestBlackjackInsurancePaysOnDealerBlackjack(t *testing.T) {
+	openTestDB(t)
+	blackjack := useFakeBlackjack(t)
+	userID := createTestUser(t, 10000)
+	betID, err := placeBet(userID, gameBlackjack, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blackjack.reply("insurance", `{"status":"dealer_win","bet":10}`)
+
+	rec := httptest.NewRecorder()
+	handleBlackjackInsurance(rec, userRequest("POST", "/api/blackjack/insurance", userID, ""))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	// 1000 staked on the hand and lost; 500 insured and paid 2:1, stake
+	// included.
+	if got := userBankroll(t, userID); got != 9000-500+1500 {
+		t.Errorf("bankroll = %d, want %d", got, 9000-500+1500)
+	}
+	if got := betStatus(t, betID); got != outcomeLost {
+		t.Errorf("bet status = %q, want lost", got)
+	}
+}
+
+func TestBlackjackInsuranceLostWithoutDealerBlackjack(t *testing.T) {
+	openTestDB(t)
+	blackjack := useFakeBlackjack(t)
+	userID := createTestUser(t, 10000)
+	betID, err := placeBet(userID, gameBlackjack, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blackjack.reply("insurance", `{"status":"playing","bet":10}`)
+
+	rec := httptest.NewRecorder()
+	handleBlackjackInsurance(rec, userRequest("POST", "/api/blackjack/insurance", userID, ""))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := userBankroll(t, userID); got != 8500 {
+		t.Errorf("bankroll = %d, want 8500", got)
+	}
+	var insurancePayout int64
+	if err := db.QueryRow("SELECT insurance_payout_cents FROM game_bets WHERE id = $1", betID).Scan(&insurancePayout); err != nil {
+		t.Fatal(err)
+	}
+	if insurancePayout != 0 {
+		t.Errorf("insurance payout = %d, want 0", insurancePayout)
+	}
+	if got := betStatus(t, betID); got != "active" {
+		t.Errorf("bet status = %q, want the hand still active", got)
+	}
+}
+
+func TestBlackjackInsuranceRejectsTooSmallBet(t *testing.T) {
+	openTestDB(t)
+	blackjack := useFakeBlackjack(t)
+	userID := createTestUser(t, 10000)
+	if _, err := placeBet(userID, gameBlackjack, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleBlackjackInsurance(rec, userRequest("POST", "/api/blackjack/insurance", userID, ""))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if _, called := blackjack.sent["insurance"]; called {
+		t.Error("insurance was sent to the blackjack service")
+	}
+	if got := userBankroll(t, userID); got != 9999 {
+		t.Errorf("bankroll = %d, want 9999", got)
+	}
+}
+
+func TestPokerShowdownSplitPotIsPush(t *testing.T) {
+	openTestDB(t)
+	poker := useFakePoker(t)
+	userID := createTestUser(t, 10000)
+	betID, err := placeBet(userID, gamePoker, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poker.reply("showdown", `{"status":"finished","winners":["Player","CPU 1"],"bet":10}`)
+
+	rec := httptest.NewRecorder()
+	handlePokerShowdown(rec, userRequest("POST", "/api/poker/showdown", userID, ""))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := betStatus(t, betID); got != outcomePush {
+		t.Errorf("bet status = %q, want push", got)
+	}
+	if got := userBankroll(t, userID); got != 10000 {
+		t.Errorf("bankroll = %d, want the stake returned", got)
+	}
+	var wins int
+	if err := db.QueryRow("SELECT poker_wins FROM users WHERE id = $1", userID).Scan(&wins); err != nil {
+		t.Fatal(err)
+	}
+	if wins != 0 {
+		t.Errorf("poker_wins = %d, want a split pot not counted as a win", wins)
+	}
+}
+
+func TestBlackjackSurrenderReturnsHalfTheStake(t *testing.T) {
+	openTestDB(t)
+	blackjack := useFakeBlackjack(t)
+	userID := createTestUser(t, 10000)
+	betID, err := placeBet(userID, gameBlackjack, 1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blackjack.reply("surrender", `{"status":"surrendered","bet":10.01}`)
+
+	rec := httptest.NewRecorder()
+	handleBlackjackSurrender(rec, userRequest("POST", "/api/blackjack/surrender", userID, ""))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := betStatus(t, betID); got != outcomeLost {
+		t.Errorf("bet status = %q, want lost", got)
+	}
+	if got := userBankroll(t, userID); got != 10000-1001+500 {
+		t.Errorf("bankroll = %d, want %d", got, 10000-1001+500)
+	}
+}
+
+func TestAuthCheck(t *testing.T) {
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		idle     time.Duration
+		at       time.Time
+		cookie   bool
+		wantCode string
+	}{
+		{"valid", 0, issued.Add(time.Hour), true, ""},
+		{"valid within the idle timeout", 30 * time.Minute, issued.Add(29 * time.Minute), true, ""},
+		{"expired", 0, issued.Add(sessionTTL + time.Minute), true, "UNAUTHORIZED"},
+		{"idle", 30 * time.Minute, issued.Add(31 * time.Minute), true, "SESSION_IDLE"},
+		{"no cookie", 0, issued, false, "UNAUTHORIZED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useIdleTimeout(t, tt.idle)
+			r := httptest.NewRequest("GET", "/api/auth/check", nil)
+			if tt.cookie {
+				r.AddCookie(sessionCookie(t, "user-1", issued))
+			}
+			useClock(t, tt.at)
+			rec := httptest.NewRecorder()
+			handleAuthCheck(rec, r)
+
+			if len(rec.Result().Cookies()) != 0 {
+				t.Errorf("check set cookies: %v", rec.Result().Cookies())
+			}
+			if tt.wantCode != "" {
+				if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != tt.wantCode {
+					t.Errorf("status = %d, body %s; want 401 %s", rec.Code, rec.Body, tt.wantCode)
+				}
+				return
+			}
+			var resp AuthCheckResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			if !resp.Authenticated || resp.UserID != "user-1" {
+				t.Errorf("response = %+v", resp)
+			}
+		})
+	}
+}
+
+func TestAuthCheckRejectsForgedToken(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cookie := sessionCookie(t, "user-1", now)
+	jwtSecret = []byte("another-secret")
+	useClock(t, now)
+
+	r := httptest.NewRequest("GET", "/api/auth/check", nil)
+	r.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handleAuthCheck(rec, r)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
+
+// roleGate runs r through requireRole(roleAdmin) and reports whether it
+// reached the handler.
+func roleGate(t *testing.T, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	t.Helper()
+	reached := false
+	h := requireRole(roleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec, reached
+}
+
+func TestRequireRoleUsesLoadedUser(t *testing.T) {
+	for _, tt := range []struct {
+		role string
+		want bool
+	}{
+		{roleAdmin, true},
+		{"player", false},
+		{"", false},
+	} {
+		t.Run(tt.role, func(t *testing.T) {
+			r := userRequest("GET", "/api/admin/stats", "user-1", "")
+			r = r.WithContext(context.WithValue(r.Context(), userKey, &User{ID: "user-1", Role: tt.role}))
+			rec, reached := roleGate(t, r)
+			if reached != tt.want {
+				t.Errorf("reached = %v, want %v", reached, tt.want)
+			}
+			if !tt.want && (rec.Code != http.StatusForbidden || errorCode(t, rec) != "FORBIDDEN") {
+				t.Errorf("status = %d, body %s; want 403 FORBIDDEN", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRequireRoleReadsRoleOnEachRequest(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 0)
+	if _, err := db.Exec("UPDATE users SET role = $1 WHERE id = $2", roleAdmin, userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, reached := roleGate(t, userRequest("GET", "/api/admin/stats", userID, "")); !reached {
+		t.Fatal("admin was refused")
+	}
+
+	// A demotion applies to the next request, without a new session.
+	if _, err := db.Exec("UPDATE users SET role = 'player' WHERE id = $1", userID); err != nil {
+		t.Fatal(err)
+	}
+	if rec, reached := roleGate(t, userRequest("GET", "/api/admin/stats", userID, "")); reached || rec.Code != http.StatusForbidden {
+		t.Errorf("demoted user: reached = %v, status = %d", reached, rec.Code)
+	}
+
+	if _, reached := roleGate(t, userRequest("GET", "/api/admin/stats", "00000000-0000-0000-0000-000000000000", "")); reached {
+		t.Error("unknown user was let through")
+	}
+}
+
+// passAuth runs r through authMiddleware and returns the response and the
+// user ID the next handler saw, if it was reached.
+func passAuth(r *http.Request) (*httptest.ResponseRecorder, string) {
+	var userID string
+	h := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Header.Get("X-User-ID")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec, userID
+}
+
+func TestSessionNeedsRefresh(t *testing.T) {
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Parsed claims hold times as float64.
+	claims := jwt.MapClaims{"iat": float64(issued.Unix()), "exp": float64(issued.Add(24 * time.Hour).Unix())}
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"fresh", issued.Add(time.Hour), false},
+		{"a quarter left", issued.Add(18 * time.Hour), false},
+		{"under a quarter left", issued.Add(18*time.Hour + time.Second), true},
+	}
+	for _, tt := range tests {
+		if got := sessionNeedsRefresh(claims, tt.at); got != tt.want {
+			t.Errorf("%s: sessionNeedsRefresh = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// Without iat the standard lifetime is assumed.
+	legacy := jwt.MapClaims{"exp": float64(issued.Add(24 * time.Hour).Unix())}
+	if !sessionNeedsRefresh(legacy, issued.Add(19*time.Hour)) {
+		t.Error("token without iat was not refreshed near expiry")
+	}
+}
+
+func TestAuthMiddlewareSlidesSession(t *testing.T) {
+	useIdleTimeout(t, 0)
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cookie := sessionCookie(t, "user-1", issued)
+
+	r := httptest.NewRequest("GET", "/api/auth/me", nil)
+	r.AddCookie(cookie)
+	useClock(t, issued.Add(time.Hour))
+	rec, userID := passAuth(r)
+	if userID != "user-1" {
+		t.Fatalf("handler saw user %q, status %d", userID, rec.Code)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("fresh session was re-issued")
+	}
+
+	r = httptest.NewRequest("GET", "/api/auth/me", nil)
+	r.AddCookie(cookie)
+	late := issued.Add(20 * time.Hour)
+	useClock(t, late)
+	rec, userID = passAuth(r)
+	if userID != "user-1" {
+		t.Fatalf("handler saw user %q, status %d", userID, rec.Code)
+	}
+	var renewed *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			renewed = c
+		}
+	}
+	if renewed == nil {
+		t.Fatal("session near expiry was not re-issued")
+	}
+	claims, err := parseSessionToken(renewed.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, _ := claims.GetExpirationTime(); exp == nil || !exp.Equal(late.Add(sessionTTL)) {
+		t.Errorf("renewed token expires %v, want %v", exp, late.Add(sessionTTL))
+	}
+}
+
+func TestAuthMiddlewareRejectsExpiredSession(t *testing.T) {
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := httptest.NewRequest("GET", "/api/auth/me", nil)
+	r.AddCookie(sessionCookie(t, "user-1", issued))
+	useClock(t, issued.Add(sessionTTL+time.Second))
+
+	rec, userID := passAuth(r)
+	if userID != "" || rec.Code != http.StatusUnauthorized {
+		t.Errorf("expired session: user %q, status %d", userID, rec.Code)
+	}
+}
+
+func TestDeletedUserWithValidSessionGets401(t *testing.T) {
+	openTestDB(t)
+	useFakeBlackjack(t)
+	userID := createTestUser(t, 10000)
+	if _, err := db.Exec("DELETE FROM users WHERE id = $1", userID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		body    string
+	}{
+		{"me", loadUser(http.HandlerFunc(handleMe)), "GET", "/api/auth/me", ""},
+		{"bankroll", loadUser(http.HandlerFunc(handleBankroll)), "GET", "/api/bankroll", ""},
+		{"limits", http.HandlerFunc(handleGetLimits), "GET", "/api/account/limits", ""},
+		{"blackjack start", http.HandlerFunc(handleBlackjackStart), "POST", "/api/blackjack/start", `{"bet":100}`},
+		{"export", http.HandlerFunc(handleAccountExport), "GET", "/api/account/export", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, userRequest(tt.method, tt.path, userID, tt.body))
+
+			if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != "USER_NOT_FOUND" {
+				t.Fatalf("status = %d, body %s; want 401 USER_NOT_FOUND", rec.Code, rec.Body)
+			}
+			cleared := false
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == sessionCookieName && c.MaxAge < 0 {
+					cleared = true
+				}
+			}
+			if !cleared {
+				t.Error("session cookie was not cleared")
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	dup := &pq.Error{Code: "23505", Constraint: usersEmailKey}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"matching constraint", dup, true},
+		{"wrapped", fmt.Errorf("create user: %w", dup), true},
+		{"other constraint", &pq.Error{Code: "23505", Constraint: activeBetKey}, false},
+		{"other error code", &pq.Error{Code: "23503", Constraint: usersEmailKey}, false},
+		{"constraint named in the message only", errors.New(`duplicate key value violates unique constraint "users_email_key"`), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isUniqueViolation(tt.err, usersEmailKey); got != tt.want {
+			t.Errorf("%s: isUniqueViolation = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestUniqueConstraintNames checks that the constraint names the code
+// matches on exist in database/schema.sql.
+func TestUniqueConstraintNames(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 10000)
+
+	_, err := createUser(fmt.Sprintf("player%d@example.com", testUserSeq), "x", "Test", "Player", "")
+	if !isUniqueViolation(err, usersEmailKey) {
+		t.Errorf("duplicate email: err = %v, want a violation of %s", err, usersEmailKey)
+	}
+
+	_, err = createUser(fmt.Sprintf("PLAYER%d@example.com", testUserSeq), "x", "Test", "Player", "")
+	if !isUniqueViolation(err, usersEmailLowerKey) {
+		t.Errorf("duplicate email in another case: err = %v, want a violation of %s", err, usersEmailLowerKey)
+	}
+
+	if _, err := placeBet(userID, gameBlackjack, 100); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO game_bets (user_id, game, bet_cents) VALUES ($1, $2, 100)", userID, gameBlackjack)
+	if !isUniqueViolation(err, activeBetKey) {
+		t.Errorf("second active bet: err = %v, want a violation of %s", err, activeBetKey)
+	}
+}
+
+func TestUnmatchedRoutesAnswerJSON(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/bankroll", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+	r.NotFoundHandler = requestIDMiddleware(http.HandlerFunc(handleNotFound))
+	r.MethodNotAllowedHandler = requestIDMiddleware(http.HandlerFunc(handleMethodNotAllowed))
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{"GET", "/api/nope", http.StatusNotFound, "NOT_FOUND"},
+		{"DELETE", "/api/bankroll", http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Request-ID", "req-7")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if resp.Code != tt.code || resp.RequestID != "req-7" {
+				t.Errorf("response = %+v, want code %s with request_id req-7", resp, tt.code)
+			}
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"jane@example.com", "jane@example.com", false},
+		{"  Jane@Example.COM ", "jane@example.com", false},
+		{"Jane Doe <Jane@Example.com>", "jane@example.com", false},
+		{`"Doe, Jane" <jane@example.com>`, "jane@example.com", false},
+		{"jane", "", true},
+		{"jane@", "", true},
+		{"@example.com", "", true},
+		{"jane@example.com, joe@example.com", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeEmail(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeEmail(%q) = %q, %v; want %q, error %v", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoginMatchesEmailCaseInsensitively(t *testing.T) {
+	openTestDB(t)
+	userID := createTestUser(t, 0)
+	setTestPassword(t, userID, "hunter22")
+	// Rows created before emails were lowercased on the way in.
+	if _, err := db.Exec("UPDATE users SET email = 'Mixed.Case@Example.com' WHERE id = $1", userID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"mixed.case@example.com", "MIXED.CASE@EXAMPLE.COM", "Mixed <mixed.case@example.com>"} {
+		rec := httptest.NewRecorder()
+		handleLogin(rec, httptest.NewRequest("POST", "/api/auth/login",
+			strings.NewReader(`{"email":`+strconv.Quote(email)+`,"password":"hunter22"}`)))
+		if rec.Code != http.StatusOK {
+			t.Errorf("login as %q: status = %d, body %s", email, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestValidateRegistrationPasswordBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"72 ascii", strings.Repeat("a", 72), false},
+		{"73 ascii", strings.Repeat("a", 73), true},
+		{"24 three-byte runes", strings.Repeat("€", 24), false},
+		{"25 three-byte runes", strings.Repeat("€", 25), true},
+		{"18 emoji", strings.Repeat("🎲", 18), false},
+		{"19 emoji", strings.Repeat("🎲", 19), true},
+		{"empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, fields := validateRegistration("jane@example.com", tt.password, "Jane", "Doe")
+			if gotErr := len(fields) > 0; gotErr != tt.wantErr {
+				t.Fatalf("fields = %v, want error %v", fields, tt.wantErr)
+			}
+			if tt.wantErr && fields[0].Field != "password" {
+				t.Errorf("error on %q, want password", fields[0].Field)
+			}
+		})
+	}
+}
+
+func TestRequireJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantPass    bool
+	}{
+		{"json", `{}`, "application/json", true},
+		{"json with charset", `{}`, "application/json; charset=utf-8", true},
+		{"no body", "", "", true},
+		{"form", "bet=100", "application/x-www-form-urlencoded", false},
+		{"text", `{}`, "text/plain", false},
+		{"missing type", `{}`, "", false},
+		{"malformed type", `{}`, "application/json; =", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/blackjack/start", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			passed := false
+			rec := httptest.NewRecorder()
+			requireJSON(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { passed = true })).ServeHTTP(rec, r)
+
+			if passed != tt.wantPass {
+				t.Errorf("passed = %v, want %v", passed, tt.wantPass)
+			}
+			if !tt.wantPass && (rec.Code != http.StatusUnsupportedMediaType || errorCode(t, rec) != "UNSUPPORTED_MEDIA_TYPE") {
+				t.Errorf("status = %d, body %s; want 415 UNSUPPORTED_MEDIA_TYPE", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONRejectsOversizedBody(t *testing.T) {
+	body := `{"bet":1,"pad":"` + strings.Repeat("x", maxRequestBodyBytes) + `"}`
+	rec := httptest.NewRecorder()
+	var req BetRequest
+	if decodeJSON(rec, httptest.NewRequest("POST", "/", strings.NewReader(body)), &req) {
+		t.Fatal("oversized body was accepted")
+	}
+	if rec.Code != http.StatusRequestEntityTooLarge || errorCode(t, rec) != "REQUEST_TOO_LARGE" {
+		t.Errorf("status = %d, body %s; want 413 REQUEST_TOO_LARGE", rec.Code, rec.Body)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		code    string
+		message string
+	}{
+		{"empty", "", "EMPTY_BODY", "Request body is empty"},
+		{"trailing data", `{"bet":1}{"bet":2}`, "INVALID_REQUEST", "Request body must contain a single JSON object"},
+		{"syntax", `{"bet":}`, "MALFORMED_JSON", "Malformed JSON at offset 8"},
+		{"truncated", `{"bet":1`, "MALFORMED_JSON", "Malformed JSON: body ends early"},
+		{"wrong field type", `{"bet":"100"}`, "INVALID_FIELD_TYPE", `Field "bet" must be an integer`},
+		{"not an object", `[1]`, "INVALID_REQUEST", "Request body must be a JSON object"},
+		{"unknown field", `{"bet":1,"wager":2}`, "UNKNOWN_FIELD", `Unknown field "wager"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			var req BetRequest
+			if decodeJSON(rec, httptest.NewRequest("POST", "/", strings.NewReader(tt.body)), &req) {
+				t.Fatal("body was accepted")
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusBadRequest || resp.Code != tt.code || resp.Error != tt.message {
+				t.Errorf("got %d %s %q, want 400 %s %q", rec.Code, resp.Code, resp.Error, tt.code, tt.message)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONAcceptsSingleObject(t *testing.T) {
+	var req BetRequest
+	rec := httptest.NewRecorder()
+	if !decodeJSON(rec, httptest.NewRequest("POST", "/", strings.NewReader(`{"bet":250}`+"\n")), &req) {
+		t.Fatalf("rejected: %s", rec.Body)
+	}
+	if req.Bet != 250 {
+		t.Errorf("bet = %d, want 250", req.Bet)
+	}
+}
+
+func TestValidateRegistrationReportsEveryField(t *testing.T) {
+	email, fields := validateRegistration("Jane <JANE@Example.com>", "hunter22", "Jane", "Doe")
+	if len(fields) != 0 || email != "jane@example.com" {
+		t.Fatalf("valid input: email %q, fields %+v", email, fields)
+	}
+
+	_, fields = validateRegistration("not-an-email", strings.Repeat("x", maxPasswordBytes+1), "", "")
+	want := []FieldError{
+		{"first_name", "First name is required"},
+		{"last_name", "Last name is required"},
+		{"email", "Enter a valid email address"},
+		{"password", passwordTooLongMessage},
+	}
+	if fmt.Sprint(fields) != fmt.Sprint(want) {
+		t.Errorf("fields = %+v, want %+v", fields, want)
+	}
+
+	_, fields = validateRegistration("", "", "Jane", "Doe")
+	if len(fields) != 2 || fields[0].Field != "email" || fields[1].Field != "password" {
+		t.Errorf("missing email and password: fields = %+v", fields)
+	}
+}
+
+func TestRegisterListsValidationFailures(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleRegister(rec, httptest.NewRequest("POST", "/api/auth/register", strings.NewReader(`{"email":"nope","password":"","first_name":"Jane","last_name":""}`)))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != "VALIDATION_FAILED" || len(resp.Fields) != 3 {
+		t.Fatalf("got %+v, want VALIDATION_FAILED with 3 fields", resp)
+	}
+	want := "Last name is required; Enter a valid email address; Password is required"
+	if resp.Error != want {
+		t.Errorf("error = %q, want %q", resp.Error, want)
+	}
+}
+
+func TestIsQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadline", context.DeadlineExceeded, true},
+		{"wrapped deadline", fmt.Errorf("load stats: %w", context.DeadlineExceeded), true},
+		{"query canceled", &pq.Error{Code: "57014"}, true},
+		{"client canceled", context.Canceled, false},
+		{"other database error", &pq.Error{Code: "23505"}, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isQueryTimeout(tt.err); got != tt.want {
+			t.Errorf("%s: isQueryTimeout = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteQueryError(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/admin/stats", nil)
+	rec := httptest.NewRecorder()
+	writeQueryError(rec, r, &pq.Error{Code: "57014"}, "Failed to load stats")
+	if rec.Code != http.StatusGatewayTimeout || errorCode(t, rec) != "QUERY_TIMEOUT" {
+		t.Errorf("timeout: status = %d, body %s; want 504 QUERY_TIMEOUT", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	writeQueryError(rec, r, errors.New("connection reset"), "Failed to load stats")
+	if rec.Code != http.StatusInternalServerError || errorCode(t, rec) != "INTERNAL_ERROR" {
+		t.Errorf("other error: status = %d, body %s; want 500 INTERNAL_ERROR", rec.Code, rec.Body)
+	}
+}
+
+func TestLeaderboardQueryTimeout(t *testing.T) {
+	openTestDB(t)
+	leaderboardCache.Lock()
+	leaderboardCache.entries = nil
+	leaderboardCache.Unlock()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	rec := httptest.NewRecorder()
+	handleLeaderboard(rec, httptest.NewRequest("GET", "/api/leaderboard", nil).WithContext(ctx))
+
+	if rec.Code != http.StatusGatewayTimeout || errorCode(t, rec) != "QUERY_TIMEOUT" {
+		t.Errorf("status = %d, body %s; want 504 QUERY_TIMEOUT", rec.Code, rec.Body)
+	}
+}
+
+func TestParseSessionTokenIssuerAndAudience(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	sessionCookie(t, "user-1", now) // configures the test secret
+	useClock(t, now)
+	sign := func(claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"user_id": "user-1",
+			"iss":     jwtIssuer,
+			"aud":     jwtAudience,
+			"iat":     now.Unix(),
+			"exp":     now.Add(time.Hour).Unix(),
+		}
+	}
+	tests := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+		wantOK bool
+	}{
+		{"valid", func(jwt.MapClaims) {}, true},
+		{"audience list", func(c jwt.MapClaims) { c["aud"] = []string{"other", jwtAudience} }, true},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "someone-else" }, false},
+		{"no issuer", func(c jwt.MapClaims) { delete(c, "iss") }, false},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "admin-tool" }, false},
+		{"no audience", func(c jwt.MapClaims) { delete(c, "aud") }, false},
+		{"no user_id", func(c jwt.MapClaims) { delete(c, "user_id") }, false},
+		{"numeric user_id", func(c jwt.MapClaims) { c["user_id"] = 7 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.mutate(claims)
+			_, err := parseSessionToken(sign(claims))
+			if (err == nil) != tt.wantOK {
+				t.Errorf("err = %v, want ok %v", err, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestReportingUsesReadDB checks that the reporting endpoints only query
+// readDB, by closing the primary connection first.
+func TestReportingUsesReadDB(t *testing.T) {
+	openTestDB(t)
+	createTestUser(t, 10000)
+	leaderboardCache.Lock()
+	leaderboardCache.entries = nil
+	leaderboardCache.Unlock()
+
+	primary, err := sql.Open("postgres", "postgres://primary.invalid/casino")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary.Close()
+	prev := db
+	db = primary
+	t.Cleanup(func() { db = prev })
+
+	for path, handler := range map[string]http.HandlerFunc{
+		"/api/leaderboard": handleLeaderboard,
+		"/api/admin/stats": handleAdminStats,
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, body %s", path, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestLoadActiveGamesConfig(t *testing.T) {
+	prev := maxActiveGames
+	t.Cleanup(func() { maxActiveGames = prev })
+	for _, v := range []string{"-1", "two"} {
+		t.Setenv("MAX_ACTIVE_SESSIONS", v)
+		if err := loadActiveGamesConfig(); err == nil {
+			t.Errorf("MAX_ACTIVE_SESSIONS=%s was accepted", v)
+		}
+	}
+	t.Setenv("MAX_ACTIVE_SESSIONS", "2")
+	if err := loadActiveGamesConfig(); err != nil || maxActiveGames != 2 {
+		t.Errorf("MAX_ACTIVE_SESSIONS=2: err %v, maxActiveGames %d", err, maxActiveGames)
+	}
+}
+
+func TestActiveGamesCap(t *testing.T) {
+	openTestDB(t)
+	prev := maxActiveGames
+	maxActiveGames = 1
+	t.Cleanup(func() { maxActiveGames = prev })
+	userID := createTestUser(t, 10000)
+
+	if _, err := placeBet(userID, gameBlackjack, 1000); err != nil {
+		t.Fatal(err)
+	}
+	_, err := placeBet(userID, gamePoker, 1000)
+	if !errors.Is(err, errTooManyGames) {
+		t.Fatalf("second game err = %v, want errTooManyGames", err)
+	}
+	if apiErr := betAPIError(err); apiErr == nil || apiErr.Status != http.StatusConflict || apiErr.Code != "TOO_MANY_SESSIONS" {
+		t.Errorf("betAPIError = %+v, want 409 TOO_MANY_SESSIONS", apiErr)
+	}
+	// The same game is still reported as a hand in progress.
+	if _, err := placeBet(userID, gameBlackjack, 1000); !errors.Is(err, errGameInProgress) {
+		t.Errorf("same game err = %v, want errGameInProgress", err)
+	}
+	if got := userBankroll(t, userID); got != 9000 {
+		t.Errorf("bankroll = %d, want only the first stake taken", got)
+	}
+
+	if _, err := settleBet(userID, gameBlackjack, 1000, outcomeLost); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := placeBet(userID, gamePoker, 1000); err != nil {
+		t.Errorf("bet after the first game ended: %v", err)
+	}
+}
+
+func TestSessionInfo(t *testing.T) {
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		idle      time.Duration
+		at        time.Time
+		wantIssue time.Time
+		wantIdle  time.Time // zero for none
+	}{
+		{"from the cookie", 0, issued.Add(time.Hour), issued, time.Time{}},
+		// Near expiry the cookie is replaced, and the new claims are reported.
+		{"after a refresh", 0, issued.Add(23 * time.Hour), issued.Add(23 * time.Hour), time.Time{}},
+		{"idle deadline", 30 * time.Minute, issued.Add(time.Minute), issued, issued.Add(30 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useIdleTimeout(t, tt.idle)
+			r := httptest.NewRequest("GET", "/api/auth/session-info", nil)
+			r.AddCookie(sessionCookie(t, "user-1", issued))
+			useClock(t, tt.at)
+			rec := httptest.NewRecorder()
+			authMiddleware(http.HandlerFunc(handleSessionInfo)).ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			var resp SessionInfoResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !resp.IssuedAt.Equal(tt.wantIssue) || !resp.ExpiresAt.Equal(tt.wantIssue.Add(sessionTTL)) || !resp.ServerTime.Equal(tt.at) {
+				t.Errorf("got %+v, want issued %v and server time %v", resp, tt.wantIssue, tt.at)
+			}
+			if (resp.IdleExpiresAt == nil) != tt.wantIdle.IsZero() ||
+				(resp.IdleExpiresAt != nil && !resp.IdleExpiresAt.Equal(tt.wantIdle)) {
+				t.Errorf("idle_expires_at = %v, want %v", resp.IdleExpiresAt, tt.wantIdle)
+			}
+			if strings.Contains(rec.Body.String(), "eyJ") {
+				t.Errorf("response exposes the token: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestSetSessionCookieClaimsReadLikeParsedOnes(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	useClock(t, now)
+	claims := setSessionCookie(httptest.NewRecorder(), "user-1")
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil || !iat.Equal(now) {
+		t.Errorf("GetIssuedAt = %v, %v; want %v", iat, err, now)
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil || !exp.Equal(now.Add(sessionTTL)) {
+		t.Errorf("GetExpirationTime = %v, %v; want %v", exp, err, now.Add(sessionTTL))
+	}
+}
+
+func TestSessionActivityStale(t *testing.T) {
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	claims := jwt.MapClaims{"iat": float64(issued.Unix())}
+	tests := []struct {
+		name string
+		idle time.Duration
+		at   time.Time
+		want bool
+	}{
+		{"no idle timeout", 0, issued.Add(time.Hour), false},
+		{"within a tenth of the timeout", 30 * time.Minute, issued.Add(3 * time.Minute), false},
+		{"past a tenth of the timeout", 30 * time.Minute, issued.Add(3*time.Minute + time.Second), true},
+	}
+	for _, tt := range tests {
+		useIdleTimeout(t, tt.idle)
+		if got := sessionActivityStale(claims, tt.at); got != tt.want {
+			t.Errorf("%s: sessionActivityStale = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	useIdleTimeout(t, 30*time.Minute)
+	if !sessionActivityStale(jwt.MapClaims{}, issued) {
+		t.Error("token without iat is not restamped")
+	}
+}
+
+// TestSchemaLowercasesEmails re-applies schema.sql, as an upgrade does, to
+// a table holding legacy mixed-case emails.
+func TestSchemaLowercasesEmails(t *testing.T) {
+	openTestDB(t)
+	schema, err := os.ReadFile("../database/schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DROP INDEX users_email_lower_key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO users (email, password_hash, first_name, last_name) VALUES ('Legacy@Example.com', 'x', 'Old', 'Player')
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("apply schema.sql: %v", err)
+	}
+	var email string
+	if err := db.QueryRow("SELECT email FROM users WHERE first_name = 'Old'").Scan(&email); err != nil || email != "legacy@example.com" {
+		t.Errorf("email = %q, %v; want legacy@example.com", email, err)
+	}
+	rec := httptest.NewRecorder()
+	handleRegister(rec, httptest.NewRequest("POST", "/api/auth/register",
+		strings.NewReader(`{"email":"LEGACY@example.com","password":"hunter22","first_name":"New","last_name":"Player"}`)))
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != "EMAIL_EXISTS" {
+		t.Errorf("register: status = %d, body %s; want 409 EMAIL_EXISTS", rec.Code, rec.Body)
+	}
+
+	// Accounts differing only by case stop the upgrade.
+	if _, err := db.Exec("DROP INDEX users_email_lower_key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO users (email, password_hash, first_name, last_name) VALUES ('LEGACY@example.com', 'x', 'Dup', 'Player')
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(schema)); err == nil || !strings.Contains(err.Error(), "differ only by email case") {
+		t.Errorf("apply schema.sql with case duplicates: err = %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "casino_http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "casino_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+// registerMetrics registers the HTTP collectors along with database pool
+// stats and a bankroll-in-circulation gauge that is computed at scrape time.
+func registerMetrics(db *sql.DB) {
+	prometheus.MustRegister(
+		httpRequestsTotal,
+		httpRequestDuration,
+		collectors.NewDBStatsCollector(db, "casino"),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "casino_bankroll_cents_total",
+			Help: "Sum of all user bankrolls in cents.",
+		}, func() float64 {
+			var total int64
+			if err := db.QueryRow("SELECT COALESCE(SUM(bankroll_cents), 0) FROM users").Scan(&total); err != nil {
+				slog.Error("Failed to read total bankroll for metrics", "err", err)
+				return 0
+			}
+			return float64(total)
+		}),
+	)
+}
+
+// metricsMiddleware records request counts and latencies labelled by the
+// route template rather than the raw path, keeping label cardinality bounded.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
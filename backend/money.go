@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// Amounts are whole cents throughout, in the single currency set by
+// CURRENCY. Formatting works on the integer, so no float rounding creeps in.
+
+// Money is an amount in cents.
+type Money int64
+
+// appCurrency is the ISO 4217 code reported alongside balances.
+var appCurrency = "USD"
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// currencySymbols prefixes amounts in these currencies with a symbol; others
+// are followed by their code.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+}
+
+func loadCurrencyConfig() error {
+	if v := os.Getenv("CURRENCY"); v != "" {
+		if !currencyPattern.MatchString(v) {
+			return fmt.Errorf("CURRENCY must be a three-letter ISO 4217 code such as USD, got %q", v)
+		}
+		appCurrency = v
+	}
+	return nil
+}
+
+// String renders m in whole units, e.g. "2500", "19.99" or "-0.05". Cents
+// are left off whole amounts.
+func (m Money) String() string {
+	sign := ""
+	abs := uint64(m)
+	if m < 0 {
+		// Negate in uint64 so the most negative int64 does not overflow.
+		sign, abs = "-", -abs
+	}
+	units := strconv.FormatUint(abs/100, 10)
+	if cents := abs % 100; cents != 0 {
+		return fmt.Sprintf("%s%s.%02d", sign, units, cents)
+	}
+	return sign + units
+}
+
+// centsFromDollars converts a dollar amount reported by a game service to
+// cents. It rounds rather than truncates, since a value such as 19.99 is
+// stored as 19.989999... and int64(19.99*100) is 1998.
+func centsFromDollars(dollars float64) int64 {
+	return int64(math.Round(dollars * 100))
+}
+
+// Display renders m in appCurrency, e.g. "$19.99", "-$5" or "19.99 CHF".
+func (m Money) Display() string {
+	s := m.String()
+	symbol, ok := currencySymbols[appCurrency]
+	if !ok {
+		return s + " " + appCurrency
+	}
+	if m < 0 {
+		return "-" + symbol + s[1:]
+	}
+	return symbol + s
+}
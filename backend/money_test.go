@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestCentsFromDollars(t *testing.T) {
+	tests := []struct {
+		dollars float64
+		want    int64
+	}{
+		{10, 1000},
+		{19.99, 1999},
+		{0.29, 29},
+		{0.1 + 0.2, 30},
+		{1.005, 100},
+		{0.005, 1},
+		{0, 0},
+		{-5.5, -550},
+		{-19.99, -1999},
+	}
+	for _, tt := range tests {
+		if got := centsFromDollars(tt.dollars); got != tt.want {
+			t.Errorf("centsFromDollars(%v) = %d, want %d", tt.dollars, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{0, "0"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1999, "19.99"},
+		{250000, "2500"},
+		{-500, "-5"},
+		{100010, "1000.10"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.m), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyDisplay(t *testing.T) {
+	prev := appCurrency
+	t.Cleanup(func() { appCurrency = prev })
+	tests := []struct {
+		currency string
+		m        Money
+		want     string
+	}{
+		{"USD", 1999, "$19.99"},
+		{"USD", -500, "-$5"},
+		{"EUR", 5, "€0.05"},
+		{"GBP", -1, "-£0.01"},
+		{"CHF", 1999, "19.99 CHF"},
+		{"CHF", -500, "-5 CHF"},
+	}
+	for _, tt := range tests {
+		appCurrency = tt.currency
+		if got := tt.m.Display(); got != tt.want {
+			t.Errorf("%s Money(%d).Display() = %q, want %q", tt.currency, int64(tt.m), got, tt.want)
+		}
+	}
+}
+
+func TestLoadCurrencyConfig(t *testing.T) {
+	prev := appCurrency
+	t.Cleanup(func() { appCurrency = prev })
+	for _, v := range []string{"usd", "EURO", "$"} {
+		t.Setenv("CURRENCY", v)
+		if err := loadCurrencyConfig(); err == nil {
+			t.Errorf("CURRENCY=%s was accepted", v)
+		}
+	}
+	t.Setenv("CURRENCY", "CHF")
+	if err := loadCurrencyConfig(); err != nil || appCurrency != "CHF" {
+		t.Errorf("CURRENCY=CHF: err %v, appCurrency %q", err, appCurrency)
+	}
+}
+
+func TestUserJSONReportsCurrency(t *testing.T) {
+	prev := appCurrency
+	appCurrency = "EUR"
+	t.Cleanup(func() { appCurrency = prev })
+
+	b, err := json.Marshal(User{ID: "user-1", BankrollCents: 1999})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["currency"] != "EUR" || got["bankroll_cents"] != float64(1999) || got["id"] != "user-1" {
+		t.Errorf("user JSON = %s", b)
+	}
+}
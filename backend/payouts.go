@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Payout table. A ratio is what a hand returns to the player, stake
+// included, as a multiple of the bet: an even-money win is 2, blackjack's
+// 3:2 natural is 5/2. Outcomes missing from a game's table (normally a
+// loss) return nothing. PAYOUTS overrides entries, e.g.
+// PAYOUTS="blackjack.natural=12/5,coinflip.won=1.96".
+
+const (
+	// outcomeNatural is a blackjack dealt as the first two cards.
+	outcomeNatural = "natural"
+	// outcomeSurrender is a blackjack hand given up before drawing. Its
+	// payout is the part of the stake handed back, so its ratio is below 1.
+	outcomeSurrender = "surrender"
+	// outcomeInsurance is an insurance side bet that the dealer had
+	// blackjack. It is paid on the insurance stake, not the hand's bet.
+	outcomeInsurance = "insurance"
+)
+
+// maxPayoutDenominator bounds a configured ratio's precision to four decimal
+// places. With ratios capped at 100, Apply's bet*Num then stays far inside
+// int64 for any bet a bankroll can hold.
+const maxPayoutDenominator = 10000
+
+type payoutRatio struct {
+	Num, Den int64
+}
+
+// Apply returns the payout for bet, rounding fractional cents down.
+func (p payoutRatio) Apply(bet int64) int64 {
+	return bet * p.Num / p.Den
+}
+
+var payoutTable = map[string]map[string]payoutRatio{
+	gameBlackjack: {
+		outcomeWon:     {2, 1},
+		outcomeNatural: {5, 2},
+		outcomePush:    {1, 1},
+		// Half the stake back; an odd cent stays with the house.
+		outcomeSurrender: {1, 2},
+		// 2:1, stake included.
+		outcomeInsurance: {3, 1},
+	},
+	gamePoker: {
+		outcomeWon: {2, 1},
+		// A pot split with a CPU player returns the stake.
+		outcomePush: {1, 1},
+	},
+	gameCoinflip: {
+		outcomeWon: {2, 1},
+	},
+}
+
+// winProbability is the chance of a win for games the backend draws itself,
+// where the house edge is known exactly. With coinflip.won=1.96 the edge is
+// 1 - 1/2 * 1.96 = 2%.
+var winProbability = map[string]*big.Rat{
+	gameCoinflip: big.NewRat(1, 2),
+}
+
+// houseEdgePercent returns the expected share of each bet the house keeps in
+// game, before rounding (which always favours the house). ok is false for
+// games whose odds are decided by a game service.
+func houseEdgePercent(game string) (edge float64, ok bool) {
+	p, known := winProbability[game]
+	if !known {
+		return 0, false
+	}
+	ratio := payoutTable[game][outcomeWon]
+	ret := new(big.Rat).Mul(p, big.NewRat(ratio.Num, ratio.Den))
+	edge, _ = new(big.Rat).Mul(new(big.Rat).Sub(big.NewRat(1, 1), ret), big.NewRat(100, 1)).Float64()
+	return edge, true
+}
+
+// payoutFor returns the amount credited for outcome on a bet of game.
+func payoutFor(game, outcome string, bet int64) int64 {
+	ratio, ok := payoutTable[game][outcome]
+	if !ok {
+		return 0
+	}
+	return ratio.Apply(bet)
+}
+
+// maxPayout returns the most a bet of game can pay out. Insurance is left
+// out: it is paid on half the bet, and only when the hand itself loses.
+func maxPayout(game string, bet int64) int64 {
+	var most int64
+	for outcome, ratio := range payoutTable[game] {
+		if outcome != outcomeInsurance {
+			most = max(most, ratio.Apply(bet))
+		}
+	}
+	return most
+}
+
+func loadPayoutConfig() error {
+	for _, entry := range splitList(os.Getenv("PAYOUTS")) {
+		key, value, ok := strings.Cut(entry, "=")
+		game, outcome, ok2 := strings.Cut(strings.TrimSpace(key), ".")
+		if !ok || !ok2 {
+			return fmt.Errorf("PAYOUTS entry %q must look like game.outcome=ratio", entry)
+		}
+		table, known := payoutTable[game]
+		if !known {
+			return fmt.Errorf("PAYOUTS entry %q: unknown game %q", entry, game)
+		}
+		if _, known := table[outcome]; !known {
+			return fmt.Errorf("PAYOUTS entry %q: %s has no %q payout", entry, game, outcome)
+		}
+		rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+		if !ok || !rat.Num().IsInt64() || !rat.Denom().IsInt64() {
+			return fmt.Errorf("PAYOUTS entry %q: ratio must be a number like 2, 1.96 or 5/2", entry)
+		}
+		if rat.Denom().Cmp(big.NewInt(maxPayoutDenominator)) > 0 {
+			return fmt.Errorf("PAYOUTS entry %q: ratio must not be finer than 1/%d", entry, maxPayoutDenominator)
+		}
+		if outcome == outcomeSurrender {
+			if rat.Sign() < 0 || rat.Cmp(big.NewRat(1, 1)) > 0 {
+				return fmt.Errorf("PAYOUTS entry %q: ratio must be between 0 and 1", entry)
+			}
+		} else if rat.Cmp(big.NewRat(1, 1)) < 0 || rat.Cmp(big.NewRat(100, 1)) > 0 {
+			// A payout below 1x would take part of the stake on a winning hand.
+			return fmt.Errorf("PAYOUTS entry %q: ratio must be between 1 and 100", entry)
+		}
+		table[outcome] = payoutRatio{Num: rat.Num().Int64(), Den: rat.Denom().Int64()}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// keepPayoutTable restores payoutTable after the test, so it can change
+// entries freely.
+func keepPayoutTable(t *testing.T) {
+	saved := map[string]map[string]payoutRatio{}
+	for game, table := range payoutTable {
+		saved[game] = map[string]payoutRatio{}
+		for outcome, ratio := range table {
+			saved[game][outcome] = ratio
+		}
+	}
+	t.Cleanup(func() { payoutTable = saved })
+}
+
+func TestPayoutTablePerGame(t *testing.T) {
+	tests := []struct {
+		game, outcome string
+		want          int64
+	}{
+		{gameBlackjack, outcomeWon, 2000},
+		{gameBlackjack, outcomeNatural, 2500},
+		{gameBlackjack, outcomePush, 1000},
+		{gameBlackjack, outcomeSurrender, 500},
+		{gameBlackjack, outcomeInsurance, 3000},
+		{gameBlackjack, outcomeLost, 0},
+		{gamePoker, outcomeWon, 2000},
+		{gamePoker, outcomePush, 1000},
+		{gamePoker, outcomeLost, 0},
+		{gameCoinflip, outcomeWon, 2000},
+		{gameCoinflip, outcomeLost, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.game+"."+tt.outcome, func(t *testing.T) {
+			if got := payoutFor(tt.game, tt.outcome, 1000); got != tt.want {
+				t.Errorf("payoutFor(%s, %s, 1000) = %d, want %d", tt.game, tt.outcome, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayoutRatioApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		ratio payoutRatio
+		bet   int64
+		want  int64
+	}{
+		{"even money", payoutRatio{2, 1}, 1001, 2002},
+		{"surrender even bet", payoutRatio{1, 2}, 1000, 500},
+		// The odd cent of a surrendered stake stays with the house.
+		{"surrender odd bet", payoutRatio{1, 2}, 1001, 500},
+		{"surrender one cent", payoutRatio{1, 2}, 1, 0},
+		{"natural rounds down", payoutRatio{5, 2}, 1001, 2502},
+		{"fractional ratio", payoutRatio{49, 25}, 999, 1958},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ratio.Apply(tt.bet); got != tt.want {
+				t.Errorf("%v.Apply(%d) = %d, want %d", tt.ratio, tt.bet, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHouseEdgePercent(t *testing.T) {
+	keepPayoutTable(t)
+	tests := []struct {
+		name  string
+		ratio payoutRatio
+		want  float64
+	}{
+		{"even money", payoutRatio{2, 1}, 0},
+		{"1.96x", payoutRatio{49, 25}, 2},
+		{"1.9x", payoutRatio{19, 10}, 5},
+		{"over 2x favours the player", payoutRatio{21, 10}, -5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payoutTable[gameCoinflip][outcomeWon] = tt.ratio
+			edge, ok := houseEdgePercent(gameCoinflip)
+			if !ok || math.Abs(edge-tt.want) > 1e-9 {
+				t.Errorf("houseEdgePercent = %v, %v; want %v, true", edge, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestHouseEdgeUnknownForServiceGames(t *testing.T) {
+	for _, game := range []string{gameBlackjack, gamePoker} {
+		if _, ok := houseEdgePercent(game); ok {
+			t.Errorf("houseEdgePercent(%s) reported an edge", game)
+		}
+	}
+}
+
+func TestLoadPayoutConfig(t *testing.T) {
+	keepPayoutTable(t)
+	t.Setenv("PAYOUTS", "blackjack.natural=12/5, coinflip.won=1.96,blackjack.surrender=0")
+	if err := loadPayoutConfig(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		game, outcome string
+		want          payoutRatio
+	}{
+		{gameBlackjack, outcomeNatural, payoutRatio{12, 5}},
+		{gameCoinflip, outcomeWon, payoutRatio{49, 25}},
+		{gameBlackjack, outcomeSurrender, payoutRatio{0, 1}},
+		{gameBlackjack, outcomeWon, payoutRatio{2, 1}},
+	} {
+		if got := payoutTable[tt.game][tt.outcome]; got != tt.want {
+			t.Errorf("%s.%s = %v, want %v", tt.game, tt.outcome, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPayoutConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, value string
+	}{
+		{"missing ratio", "coinflip.won"},
+		{"missing outcome", "coinflip=2"},
+		{"unknown game", "roulette.won=36"},
+		{"unknown outcome", "coinflip.push=1"},
+		{"not a number", "coinflip.won=double"},
+		{"win below stake", "coinflip.won=0.9"},
+		{"win too large", "coinflip.won=101"},
+		{"surrender over stake", "blackjack.surrender=1.5"},
+		{"negative surrender", "blackjack.surrender=-1/2"},
+		{"too precise", "coinflip.won=1.96001"},
+		{"huge terms", "coinflip.won=999999999999999/10000000000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keepPayoutTable(t)
+			t.Setenv("PAYOUTS", tt.value)
+			if err := loadPayoutConfig(); err == nil {
+				t.Errorf("PAYOUTS=%q was accepted", tt.value)
+			}
+		})
+	}
+}
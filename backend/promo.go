@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Promo codes credit a one-off bonus on top of the starting bankroll when an
+// account is created. Codes live in promo_codes and may carry an expiry and a
+// usage limit.
+
+var errInvalidPromoCode = errors.New("invalid promo code")
+
+// promoCodesStrict makes registration fail on an unknown, expired or used-up
+// code. Otherwise such codes are ignored and the account gets the default
+// bankroll.
+var promoCodesStrict = false
+
+func loadPromoConfig() error {
+	if v := os.Getenv("PROMO_CODES_STRICT"); v != "" {
+		strict, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("PROMO_CODES_STRICT must be a boolean, got %q", v)
+		}
+		promoCodesStrict = strict
+	}
+	return nil
+}
+
+// applyPromoCode redeems code for userID inside tx and credits its bonus. It
+// returns the new balance, or errInvalidPromoCode if the code does not exist,
+// has expired or has no uses left.
+func applyPromoCode(tx *sql.Tx, userID, code string) (int64, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	var bonus int64
+	err := tx.QueryRow(`
+		UPDATE promo_codes SET uses = uses + 1
+		WHERE code = $1
+		  AND (expires_at IS NULL OR expires_at > now())
+		  AND (max_uses IS NULL OR uses < max_uses)
+		RETURNING bonus_cents
+	`, code).Scan(&bonus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errInvalidPromoCode
+	}
+	if err != nil {
+		return 0, err
+	}
+	return writeBankrollChange(tx, userID, bonus, reasonPromoBonus, code, false)
+}
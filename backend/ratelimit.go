@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter allows up to limit events per key in each fixed window. It is
+// in-memory, so every backend instance counts separately.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	windows   map[string]*rateWindow
+	lastPrune time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, windows: make(map[string]*rateWindow)}
+}
+
+// Allow records an event for key. If key is over its limit it returns false
+// and how long until the window resets. A limit of 0 allows everything.
+func (l *rateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := appClock.Now()
+	if now.Sub(l.lastPrune) >= l.window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		l.lastPrune = now
+	}
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// setRetryAfter sets Retry-After to wait, rounded up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// registerLimiter caps registration attempts per client IP, since each one
+// costs a bcrypt hash. REGISTER_RATE_LIMIT sets attempts per hour.
+var registerLimiter = newRateLimiter(10, time.Hour)
+
+func loadRateLimitConfig() error {
+	if v := os.Getenv("REGISTER_RATE_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("REGISTER_RATE_LIMIT must be a non-negative integer, got %q", v)
+		}
+		registerLimiter = newRateLimiter(n, time.Hour)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useRegisterLimiter(t *testing.T, l *rateLimiter) {
+	prev := registerLimiter
+	registerLimiter = l
+	t.Cleanup(func() { registerLimiter = prev })
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	useClock(t, start)
+	l := newRateLimiter(2, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("attempt %d refused", i+1)
+		}
+	}
+	useClock(t, start.Add(15*time.Minute))
+	if ok, wait := l.Allow("a"); ok || wait != 45*time.Minute {
+		t.Errorf("over the limit: ok %v, wait %v; want refused for 45m", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another key was refused")
+	}
+
+	useClock(t, start.Add(time.Hour))
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("refused after the window reset")
+	}
+
+	useClock(t, start.Add(2*time.Hour))
+	l.Allow("c")
+	if _, ok := l.windows["b"]; ok {
+		t.Error("expired window for b was not pruned")
+	}
+}
+
+func TestRateLimiterZeroLimitAllowsEverything(t *testing.T) {
+	l := newRateLimiter(0, time.Hour)
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("attempt %d refused", i+1)
+		}
+	}
+}
+
+func TestLoadRateLimitConfig(t *testing.T) {
+	useRegisterLimiter(t, registerLimiter)
+	for _, v := range []string{"-1", "ten"} {
+		t.Setenv("REGISTER_RATE_LIMIT", v)
+		if err := loadRateLimitConfig(); err == nil {
+			t.Errorf("REGISTER_RATE_LIMIT=%s was accepted", v)
+		}
+	}
+	t.Setenv("REGISTER_RATE_LIMIT", "3")
+	if err := loadRateLimitConfig(); err != nil || registerLimiter.limit != 3 {
+		t.Errorf("REGISTER_RATE_LIMIT=3: err %v, limit %d", err, registerLimiter.limit)
+	}
+}
+
+func TestRegisterRateLimited(t *testing.T) {
+	useClock(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	useRegisterLimiter(t, newRateLimiter(1, time.Hour))
+	registerLimiter.Allow("192.0.2.1")
+
+	register := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/auth/register", strings.NewReader(body))
+		r.RemoteAddr = "192.0.2.1:5000"
+		rec := httptest.NewRecorder()
+		handleRegister(rec, r)
+		return rec
+	}
+
+	rec := register(`{"email":"jane@example.com","password":"hunter22","first_name":"Jane","last_name":"Doe"}`)
+	if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != "RATE_LIMITED" {
+		t.Fatalf("status = %d, body %s; want 429 RATE_LIMITED", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After = %q, want 3600", got)
+	}
+
+	// Invalid input is rejected before it counts against the limit.
+	rec = register(`{"email":"","password":"","first_name":"","last_name":""}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid input: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestRegisterIgnoresSpoofedRealIP(t *testing.T) {
+	useClock(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	useRegisterLimiter(t, newRateLimiter(1, time.Hour))
+	registerLimiter.Allow("192.0.2.1")
+
+	for _, spoofed := range []string{"198.51.100.1", "198.51.100.2"} {
+		r := httptest.NewRequest("POST", "/api/auth/register", strings.NewReader(`{"email":"jane@example.com","password":"hunter22","first_name":"Jane","last_name":"Doe"}`))
+		r.RemoteAddr = "192.0.2.1:5000"
+		r.Header.Set("X-Real-IP", spoofed)
+		rec := httptest.NewRecorder()
+		handleRegister(rec, r)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("X-Real-IP %s: status = %d, want 429", spoofed, rec.Code)
+		}
+	}
+}
+
+func TestRemoteIPTrustsConfiguredProxies(t *testing.T) {
+	prev := trustedProxies
+	t.Cleanup(func() { trustedProxies = prev })
+
+	request := func(remoteAddr string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Real-IP", "198.51.100.7")
+		return r
+	}
+	if got := remoteIP(request("127.0.0.1:41000")); got != "198.51.100.7" {
+		t.Errorf("via loopback proxy: remoteIP = %q, want the header", got)
+	}
+	if got := remoteIP(request("192.0.2.1:5000")); got != "192.0.2.1" {
+		t.Errorf("direct client: remoteIP = %q, want the peer address", got)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+	if err := loadTrustedProxyConfig(); err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []string{"10.1.2.3:80", "192.0.2.1:5000"} {
+		if got := remoteIP(request(addr)); got != "198.51.100.7" {
+			t.Errorf("via %s: remoteIP = %q, want the header", addr, got)
+		}
+	}
+	if got := remoteIP(request("127.0.0.1:41000")); got != "127.0.0.1" {
+		t.Errorf("loopback no longer trusted: remoteIP = %q", got)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "nginx")
+	if err := loadTrustedProxyConfig(); err == nil {
+		t.Error("TRUSTED_PROXIES=nginx was accepted")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bootstrap data for a fresh deployment, run with `backend -seed`. Every
+// insert skips rows that already exist, so seeding twice is harmless.
+
+type seedUser struct {
+	Email     string
+	FirstName string
+	LastName  string
+	Role      string
+}
+
+var demoPlayers = []seedUser{
+	{Email: "alice@demo.casino", FirstName: "Alice", LastName: "Demo", Role: "player"},
+	{Email: "bob@demo.casino", FirstName: "Bob", LastName: "Demo", Role: "player"},
+	{Email: "carol@demo.casino", FirstName: "Carol", LastName: "Demo", Role: "player"},
+}
+
+// runSeed creates the admin from SEED_ADMIN_EMAIL and SEED_ADMIN_PASSWORD
+// and, when demo is set, a few verified demo players sharing
+// SEED_DEMO_PASSWORD (a random one is generated and logged if unset).
+func runSeed(demo bool) error {
+	email, password := os.Getenv("SEED_ADMIN_EMAIL"), os.Getenv("SEED_ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		return errors.New("SEED_ADMIN_EMAIL and SEED_ADMIN_PASSWORD are required")
+	}
+	normalized, err := normalizeEmail(email)
+	if err != nil {
+		return fmt.Errorf("invalid SEED_ADMIN_EMAIL: %w", err)
+	}
+	admin := seedUser{Email: normalized, FirstName: "Casino", LastName: "Admin", Role: roleAdmin}
+	if err := seedAccount(admin, password); err != nil {
+		return err
+	}
+	if !demo {
+		return nil
+	}
+
+	demoPassword := os.Getenv("SEED_DEMO_PASSWORD")
+	if demoPassword == "" {
+		b := make([]byte, 9)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		demoPassword = hex.EncodeToString(b)
+		slog.Info("Generated demo player password", "password", demoPassword)
+	}
+	for _, u := range demoPlayers {
+		if err := seedAccount(u, demoPassword); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seedAccount(u seedUser, password string) error {
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password for %s is longer than %d bytes", u.Email, maxPasswordBytes)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec(`
+		INSERT INTO users (email, password_hash, first_name, last_name, role, email_verified)
+		VALUES ($1, $2, $3, $4, $5, TRUE)
+		ON CONFLICT (email) DO NOTHING
+	`, u.Email, string(hash), u.FirstName, u.LastName, u.Role)
+	if err != nil {
+		return fmt.Errorf("seed %s: %w", u.Email, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		slog.Info("Seed account already exists, skipping", "email", u.Email)
+		return nil
+	}
+	slog.Info("Created seed account", "email", u.Email, "role", u.Role)
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// A game session, as the API calls it, is one recorded bet in game_bets.
+
+type GameSession struct {
+	ID          string `json:"id"`
+	Game        string `json:"game"`
+	Status      string `json:"status"`
+	BetCents    int64  `json:"bet_cents"`
+	PayoutCents *int64 `json:"payout_cents"`
+	// InsuranceCents and InsurancePayoutCents are set once a blackjack hand
+	// is insured and the insurance is settled.
+	InsuranceCents       *int64     `json:"insurance_cents,omitempty"`
+	InsurancePayoutCents *int64     `json:"insurance_payout_cents,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	SettledAt            *time.Time `json:"settled_at"`
+	// Fair reports whether the outcome was drawn by the backend and can be
+	// checked through /api/games/{id}/fairness.
+	Fair bool `json:"provably_fair"`
+}
+
+// gameSessionColumns are the game_bets columns scanGameSession reads.
+const gameSessionColumns = `id, game, status, bet_cents, payout_cents, insurance_cents, insurance_payout_cents,
+			created_at, settled_at, server_seed_hash IS NOT NULL`
+
+// scanGameSession reads a row selected with gameSessionColumns.
+func scanGameSession(row interface{ Scan(...interface{}) error }) (GameSession, error) {
+	var s GameSession
+	var payout, insurance, insurancePayout sql.NullInt64
+	var settled sql.NullTime
+	err := row.Scan(&s.ID, &s.Game, &s.Status, &s.BetCents, &payout, &insurance, &insurancePayout,
+		&s.CreatedAt, &settled, &s.Fair)
+	if err != nil {
+		return s, err
+	}
+	if payout.Valid {
+		s.PayoutCents = &payout.Int64
+	}
+	if insurance.Valid {
+		s.InsuranceCents = &insurance.Int64
+	}
+	if insurancePayout.Valid {
+		s.InsurancePayoutCents = &insurancePayout.Int64
+	}
+	if settled.Valid {
+		s.SettledAt = &settled.Time
+	}
+	return s, nil
+}
+
+// handleGameSession returns one of the user's sessions. Sessions belonging to
+// someone else are reported as not found so their IDs cannot be probed.
+func handleGameSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	id := mux.Vars(r)["sessionId"]
+	if !uuidPattern.MatchString(id) {
+		writeError(w, r, http.StatusBadRequest, "Invalid session ID", "INVALID_REQUEST")
+		return
+	}
+
+	s, err := scanGameSession(db.QueryRow(`
+		SELECT `+gameSessionColumns+`
+		FROM game_bets WHERE id = $1 AND user_id = $2
+	`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, http.StatusNotFound, "Session not found", "NOT_FOUND")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load game session", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		slog.Error("Failed to encode game session response", "err", err)
+	}
+}
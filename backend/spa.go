@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Optional single-page-app mode. With SPA_DIR pointing at the built frontend
+// (frontend/dist), the backend serves it for any GET the router does not
+// match, so client-side routes such as /lobby survive a page reload.
+
+// spaHandler serves files from dir for unmatched requests. Existing files are
+// served as they are; other GETs for paths without a file extension get
+// index.html. API paths, missing assets and other methods go to notFound so
+// they still get a JSON 404.
+func spaHandler(dir string, notFound http.Handler) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	index := filepath.Join(dir, "index.html")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		clean := path.Clean("/" + r.URL.Path)
+		if clean == "/api" || strings.HasPrefix(clean, "/api/") {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(clean))); err == nil && !info.IsDir() {
+			files.ServeHTTP(w, r)
+			return
+		}
+		if path.Ext(clean) != "" {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		// index.html must not be cached, so a new deploy is picked up.
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFile(w, r, index)
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSPAHandler(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<div id=app></div>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets", "app.js"), []byte("boot()"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, "Not found", "NOT_FOUND")
+	})
+	handler := spaHandler(dir, notFound)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"root", "GET", "/", http.StatusOK, "<div id=app></div>"},
+		{"client route", "GET", "/lobby", http.StatusOK, "<div id=app></div>"},
+		{"nested client route", "GET", "/games/blackjack", http.StatusOK, "<div id=app></div>"},
+		{"asset", "GET", "/assets/app.js", http.StatusOK, "boot()"},
+		{"missing asset", "GET", "/assets/gone.js", http.StatusNotFound, "NOT_FOUND"},
+		{"api", "GET", "/api/nothing", http.StatusNotFound, "NOT_FOUND"},
+		{"api root", "GET", "/api", http.StatusNotFound, "NOT_FOUND"},
+		{"api via dot segments", "GET", "/lobby/../api/nothing", http.StatusNotFound, "NOT_FOUND"},
+		{"post", "POST", "/lobby", http.StatusNotFound, "NOT_FOUND"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("status = %d, body %q; want %d containing %q", rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/lobby", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("index Cache-Control = %q, want no-cache", got)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// W3C Trace Context propagation. An incoming traceparent is continued, so
+// the backend's hop joins the caller's trace; otherwise a new trace is
+// started. Each call to a game service is sent as a child with a fresh span
+// ID, alongside the request's X-Request-ID. The backend does not record spans
+// itself; it only carries the context through and logs the trace ID.
+
+const traceKey contextKey = "trace"
+
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+const (
+	zeroTraceID = "00000000000000000000000000000000"
+	zeroSpanID  = "0000000000000000"
+)
+
+// traceContext is the part of a trace that outgoing calls inherit.
+type traceContext struct {
+	TraceID string
+	Flags   string
+	// State is the incoming tracestate, passed through unchanged.
+	State string
+}
+
+// traceFromRequest continues the trace in r's traceparent header, or starts
+// a sampled one if the header is missing or malformed.
+func traceFromRequest(r *http.Request) traceContext {
+	if m := traceparentPattern.FindStringSubmatch(r.Header.Get("traceparent")); m != nil &&
+		m[1] != zeroTraceID && m[2] != zeroSpanID {
+		return traceContext{TraceID: m[1], Flags: m[3], State: r.Header.Get("tracestate")}
+	}
+	return traceContext{TraceID: randomHex(16), Flags: "01"}
+}
+
+func traceFromContext(ctx context.Context) (traceContext, bool) {
+	tc, ok := ctx.Value(traceKey).(traceContext)
+	return tc, ok
+}
+
+// setTraceHeaders marks req, an outgoing call made on behalf of ctx's
+// request, with that request's ID and trace.
+func setTraceHeaders(ctx context.Context, req *http.Request) {
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	tc, ok := traceFromContext(ctx)
+	if !ok {
+		return
+	}
+	req.Header.Set("traceparent", "00-"+tc.TraceID+"-"+randomHex(8)+"-"+tc.Flags)
+	if tc.State != "" {
+		req.Header.Set("tracestate", tc.State)
+	}
+}
+
+// randomHex returns n random bytes hex-encoded. If the system source fails it
+// returns zeros, which receivers treat as an invalid ID and replace.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString(make([]byte, n))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceFromRequest(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name        string
+		traceparent string
+		tracestate  string
+		continued   bool
+	}{
+		{"valid", "00-" + traceID + "-00f067aa0ba902b7-01", "vendor=1", true},
+		{"unsampled", "00-" + traceID + "-00f067aa0ba902b7-00", "", true},
+		{"missing", "", "", false},
+		{"unknown version", "01-" + traceID + "-00f067aa0ba902b7-01", "", false},
+		{"uppercase", "00-" + strings.ToUpper(traceID) + "-00f067aa0ba902b7-01", "", false},
+		{"zero trace ID", "00-" + zeroTraceID + "-00f067aa0ba902b7-01", "", false},
+		{"zero span ID", "00-" + traceID + "-" + zeroSpanID + "-01", "", false},
+		{"truncated", "00-" + traceID[:31] + "-00f067aa0ba902b7-01", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.traceparent != "" {
+				r.Header.Set("traceparent", tt.traceparent)
+			}
+			if tt.tracestate != "" {
+				r.Header.Set("tracestate", tt.tracestate)
+			}
+			tc := traceFromRequest(r)
+			if tt.continued {
+				flags := tt.traceparent[len(tt.traceparent)-2:]
+				if tc.TraceID != traceID || tc.Flags != flags || tc.State != tt.tracestate {
+					t.Errorf("got %+v, want trace %s flags %s state %q", tc, traceID, flags, tt.tracestate)
+				}
+				return
+			}
+			if !traceparentPattern.MatchString("00-"+tc.TraceID+"-00f067aa0ba902b7-"+tc.Flags) ||
+				tc.TraceID == traceID || tc.TraceID == zeroTraceID || tc.Flags != "01" || tc.State != "" {
+				t.Errorf("got %+v, want a new sampled trace", tc)
+			}
+		})
+	}
+}
+
+func TestSetTraceHeaders(t *testing.T) {
+	tc := traceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", Flags: "01", State: "vendor=1"}
+	ctx := context.WithValue(context.Background(), requestIDKey, "req-1")
+	ctx = context.WithValue(ctx, traceKey, tc)
+
+	var spans []string
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		setTraceHeaders(ctx, req)
+		m := traceparentPattern.FindStringSubmatch(req.Header.Get("traceparent"))
+		if m == nil || m[1] != tc.TraceID || m[3] != tc.Flags {
+			t.Fatalf("traceparent = %q", req.Header.Get("traceparent"))
+		}
+		spans = append(spans, m[2])
+		if got := req.Header.Get("tracestate"); got != tc.State {
+			t.Errorf("tracestate = %q, want %q", got, tc.State)
+		}
+		if got := req.Header.Get("X-Request-ID"); got != "req-1" {
+			t.Errorf("X-Request-ID = %q, want req-1", got)
+		}
+	}
+	if spans[0] == spans[1] {
+		t.Errorf("both calls used span ID %s", spans[0])
+	}
+}
+
+func TestSetTraceHeadersWithoutTrace(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	setTraceHeaders(context.Background(), req)
+	for _, h := range []string{"traceparent", "tracestate", "X-Request-ID"} {
+		if got := req.Header.Get(h); got != "" {
+			t.Errorf("%s = %q, want unset", h, got)
+		}
+	}
+}
+
+func TestGameServiceCallContinuesTrace(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+	svc := &httpGameService{name: "test", baseURL: upstream.URL, statePath: "/state"}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := svc.State(r.Context(), "user-1"); err != nil {
+			t.Error(err)
+		}
+	}))
+	r := httptest.NewRequest("GET", "/api/blackjack/state", nil)
+	r.Header.Set("X-Request-ID", "req-42")
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	m := traceparentPattern.FindStringSubmatch(got.Get("traceparent"))
+	if m == nil || m[1] != traceID || m[2] == "00f067aa0ba902b7" {
+		t.Errorf("upstream traceparent = %q, want trace %s with a new span", got.Get("traceparent"), traceID)
+	}
+	if id := got.Get("X-Request-ID"); id != "req-42" {
+		t.Errorf("upstream X-Request-ID = %q, want req-42", id)
+	}
+}
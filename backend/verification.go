@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Email verification. New accounts must confirm their address before they
+// can place bets; accounts that existed before this feature are treated as
+// verified by the migration.
+
+const (
+	verificationTokenTTL = 24 * time.Hour
+	// verificationResendCooldown is the minimum time between verification
+	// emails to the same account.
+	verificationResendCooldown = time.Minute
+)
+
+// emailSender delivers verification links. Swap in a real mail provider for
+// production; the default just logs the link.
+type emailSender interface {
+	SendVerification(email, link string) error
+	// SendEmailChange sends the link that confirms a new address to that
+	// address.
+	SendEmailChange(email, link string) error
+}
+
+type logEmailSender struct{}
+
+func (logEmailSender) SendVerification(email, link string) error {
+	slog.Info("Verification link", "email", email, "link", link)
+	return nil
+}
+
+func (logEmailSender) SendEmailChange(email, link string) error {
+	slog.Info("Email change link", "email", email, "link", link)
+	return nil
+}
+
+var mailer emailSender = logEmailSender{}
+
+func appBaseURL() string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		return "http://localhost:8080"
+	}
+	return base
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newEmailToken returns a random token for an emailed link.
+func newEmailToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// sendVerificationEmail issues a fresh token for the user, replacing any
+// outstanding one, and sends the verification link. Only the token's hash is
+// stored.
+func sendVerificationEmail(userID, email string) error {
+	token, err := newEmailToken()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE users SET email_verification_token_hash = $1, email_verification_sent_at = now()
+		WHERE id = $2
+	`, hashToken(token), userID)
+	if err != nil {
+		return err
+	}
+	return mailer.SendVerification(email, appBaseURL()+"/api/auth/verify?token="+url.QueryEscape(token))
+}
+
+func handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing token", "INVALID_TOKEN")
+		return
+	}
+	var userID string
+	err := db.QueryRow(`
+		UPDATE users SET email_verified = TRUE, email_verification_token_hash = NULL
+		WHERE email_verification_token_hash = $1 AND email_verification_sent_at > $2
+		RETURNING id
+	`, hashToken(token), appClock.Now().Add(-verificationTokenTTL)).Scan(&userID)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid or expired token", "INVALID_TOKEN")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"verified": true}); err != nil {
+		slog.Error("Failed to encode verify response", "err", err)
+	}
+}
+
+// handleResendVerification issues a new verification link to the logged-in
+// user, invalidating the previous one. Already verified accounts get the same
+// response without an email being sent.
+func handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	var email string
+	var verified bool
+	var sentAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT email, email_verified, email_verification_sent_at FROM users WHERE id = $1
+	`, userID).Scan(&email, &verified, &sentAt)
+	if err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	if !verified {
+		if sentAt.Valid {
+			if wait := verificationResendCooldown - appClock.Now().Sub(sentAt.Time); wait > 0 {
+				setRetryAfter(w, wait)
+				writeError(w, r, http.StatusTooManyRequests, "Please wait before requesting another verification email", "RATE_LIMITED")
+				return
+			}
+		}
+		if err := sendVerificationEmail(userID, email); err != nil {
+			slog.Error("Failed to send verification email", "user_id", userID, "err", err)
+			writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"sent": true}); err != nil {
+		slog.Error("Failed to encode resend verification response", "err", err)
+	}
+}
+
+// Email changes. The new address is held in pending_email until the link
+// sent to it is followed, so an account can only move to an inbox its owner
+// controls. Sessions identify users by ID, so they stay valid across the
+// change.
+
+type EmailChangeRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+func handleEmailChange(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	var req EmailChangeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	newEmail, err := normalizeEmail(req.NewEmail)
+	if err != nil {
+		writeValidationError(w, r, []FieldError{{Field: "new_email", Message: "Enter a valid email address"}})
+		return
+	}
+
+	var hash, current string
+	err = db.QueryRow("SELECT password_hash, email FROM users WHERE id = $1", userID).Scan(&hash, &current)
+	if err != nil {
+		writeUserLookupError(w, r, err)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)); err != nil {
+		writeError(w, r, http.StatusUnauthorized, "Invalid credentials", "INVALID_CREDENTIALS")
+		return
+	}
+	if newEmail == current {
+		writeError(w, r, http.StatusBadRequest, "That is already your email address", "INVALID_REQUEST")
+		return
+	}
+	// Checked again on confirmation, since the address may be taken meanwhile.
+	var taken bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE lower(email) = $1)", newEmail).Scan(&taken); err != nil {
+		slog.Error("Failed to check email availability", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	if taken {
+		writeError(w, r, http.StatusConflict, "Email already exists", "EMAIL_EXISTS")
+		return
+	}
+
+	token, err := newEmailToken()
+	if err == nil {
+		_, err = db.Exec(`
+			UPDATE users SET pending_email = $1, email_change_token_hash = $2, email_change_sent_at = now()
+			WHERE id = $3
+		`, newEmail, hashToken(token), userID)
+	}
+	if err == nil {
+		err = mailer.SendEmailChange(newEmail, appBaseURL()+"/api/auth/email/confirm?token="+url.QueryEscape(token))
+	}
+	if err != nil {
+		slog.Error("Failed to start email change", "user_id", userID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"pending_email": newEmail}); err != nil {
+		slog.Error("Failed to encode email change response", "err", err)
+	}
+}
+
+// handleConfirmEmailChange swaps the pending address in. The new address
+// counts as verified, since the token proves the user received mail there.
+func handleConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing token", "INVALID_TOKEN")
+		return
+	}
+	var email string
+	err := db.QueryRow(`
+		UPDATE users SET email = pending_email, email_verified = TRUE,
+			pending_email = NULL, email_change_token_hash = NULL, email_change_sent_at = NULL
+		WHERE email_change_token_hash = $1 AND email_change_sent_at > $2
+		RETURNING email
+	`, hashToken(token), appClock.Now().Add(-verificationTokenTTL)).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, http.StatusBadRequest, "Invalid or expired token", "INVALID_TOKEN")
+		return
+	}
+	if isEmailTaken(err) {
+		writeError(w, r, http.StatusConflict, "Email already exists", "EMAIL_EXISTS")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to confirm email change", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Server error", "INTERNAL_ERROR")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"email": email}); err != nil {
+		slog.Error("Failed to encode email confirm response", "err", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Outbound webhooks tell the game services about account changes that should
+// end gameplay, such as a self-exclusion, so they can tear down open hands.
+// Each event is POSTed as JSON to WEBHOOK_URL with an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed by WEBHOOK_SECRET:
+//
+//	X-Webhook-Timestamp: 1700000000
+//	X-Webhook-Signature: sha256=<hex>
+//
+// Receivers should recompute the signature and reject stale timestamps.
+// Delivery is best-effort: it runs in the background and is retried with
+// backoff, but an event that still fails is only logged.
+
+const (
+	eventSessionForceClosed = "session.force_closed"
+	eventUserSelfExcluded   = "user.self_excluded"
+	eventUserDeleted        = "user.deleted"
+)
+
+const (
+	webhookAttempts    = 5
+	webhookBaseBackoff = time.Second
+)
+
+var (
+	webhookURL    string
+	webhookSecret []byte
+	webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+	// webhookDeliveries tracks background deliveries so shutdown can wait
+	// for them.
+	webhookDeliveries sync.WaitGroup
+)
+
+// WebhookEvent is the body of a webhook request.
+type WebhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+func loadWebhookConfig() error {
+	v := os.Getenv("WEBHOOK_URL")
+	if v == "" {
+		return nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("WEBHOOK_URL must be an http or https URL with a host, got %q", v)
+	}
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if secret == "" {
+		return errors.New("WEBHOOK_SECRET is required when WEBHOOK_URL is set")
+	}
+	webhookURL = v
+	webhookSecret = []byte(secret)
+	return nil
+}
+
+// signWebhook returns the X-Webhook-Signature value for body sent at ts.
+func signWebhook(ts string, body []byte) string {
+	mac := hmac.New(sha256.New, webhookSecret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyWebhook queues eventType for delivery. It does nothing when no
+// WEBHOOK_URL is configured.
+func notifyWebhook(eventType string, data map[string]interface{}) {
+	if webhookURL == "" {
+		return
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		slog.Error("Failed to create webhook event ID", "event", eventType, "err", err)
+		return
+	}
+	event := WebhookEvent{ID: hex.EncodeToString(id), Type: eventType, CreatedAt: appClock.Now().UTC(), Data: data}
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to encode webhook event", "event", eventType, "err", err)
+		return
+	}
+	webhookDeliveries.Add(1)
+	go func() {
+		defer webhookDeliveries.Done()
+		deliverWebhook(event, body)
+	}()
+}
+
+// deliverWebhook posts body, retrying failures and 5xx responses with
+// doubling backoff. Each attempt is signed afresh so its timestamp is
+// current.
+func deliverWebhook(event WebhookEvent, body []byte) {
+	backoff := webhookBaseBackoff
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(event, body)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			slog.Error("Webhook delivery failed", "event", event.Type, "event_id", event.ID, "attempts", attempt, "err", err)
+			return
+		}
+		slog.Warn("Webhook delivery failed; retrying", "event", event.Type, "event_id", event.ID, "attempt", attempt, "err", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postWebhook(event WebhookEvent, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	req.Header.Set("X-Webhook-Signature", signWebhook(ts, body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("receiver returned %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= 300 {
+		// A 4xx will not change on retry.
+		slog.Error("Webhook rejected", "event", event.Type, "event_id", event.ID, "status", resp.StatusCode)
+	}
+	return nil
+}
+
+// drainWebhooks waits for queued deliveries until ctx is done.
+func drainWebhooks(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		webhookDeliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Shutting down with webhook deliveries pending")
+	}
+}
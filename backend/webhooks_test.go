@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records deliveries and answers them with statuses in turn,
+// then 200.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (rc *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.bodies = append(rc.bodies, body)
+	rc.headers = append(rc.headers, r.Header.Clone())
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// useWebhookReceiver points webhooks at a test server that replies with
+// statuses.
+func useWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	rc := &webhookReceiver{statuses: statuses}
+	srv := httptest.NewServer(rc)
+	prevURL, prevSecret := webhookURL, webhookSecret
+	webhookURL, webhookSecret = srv.URL, []byte("hook-secret")
+	t.Cleanup(func() {
+		webhookURL, webhookSecret = prevURL, prevSecret
+		srv.Close()
+	})
+	return rc
+}
+
+func waitForWebhooks(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	drainWebhooks(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("webhook deliveries did not finish")
+	}
+}
+
+func TestLoadWebhookConfig(t *testing.T) {
+	prevURL, prevSecret := webhookURL, webhookSecret
+	t.Cleanup(func() { webhookURL, webhookSecret = prevURL, prevSecret })
+	tests := []struct {
+		url, secret string
+		wantErr     bool
+	}{
+		{"", "", false},
+		{"https://games.internal/hooks", "s3cret", false},
+		{"https://games.internal/hooks", "", true},
+		{"ftp://games.internal/hooks", "s3cret", true},
+		{"https:///hooks", "s3cret", true},
+	}
+	for _, tt := range tests {
+		webhookURL, webhookSecret = "", nil
+		t.Setenv("WEBHOOK_URL", tt.url)
+		t.Setenv("WEBHOOK_SECRET", tt.secret)
+		err := loadWebhookConfig()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q/%q: err = %v, wantErr %v", tt.url, tt.secret, err, tt.wantErr)
+		}
+		if err == nil && webhookURL != tt.url {
+			t.Errorf("%q: webhookURL = %q", tt.url, webhookURL)
+		}
+	}
+}
+
+func TestNotifyWebhookSignsEvent(t *testing.T) {
+	rc := useWebhookReceiver(t)
+	notifyWebhook(eventUserSelfExcluded, map[string]interface{}{"user_id": "user-1"})
+	waitForWebhooks(t)
+
+	if len(rc.bodies) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(rc.bodies))
+	}
+	body, h := rc.bodies[0], rc.headers[0]
+	mac := hmac.New(sha256.New, []byte("hook-secret"))
+	mac.Write([]byte(h.Get("X-Webhook-Timestamp") + "."))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); h.Get("X-Webhook-Signature") != want {
+		t.Errorf("signature = %q, want %q", h.Get("X-Webhook-Signature"), want)
+	}
+	if h.Get("X-Webhook-Event") != eventUserSelfExcluded {
+		t.Errorf("X-Webhook-Event = %q", h.Get("X-Webhook-Event"))
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != eventUserSelfExcluded || event.Data["user_id"] != "user-1" || len(event.ID) != 32 {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestWebhookRetriesServerErrors(t *testing.T) {
+	rc := useWebhookReceiver(t, http.StatusBadGateway)
+	notifyWebhook(eventUserDeleted, map[string]interface{}{"user_id": "user-1"})
+	waitForWebhooks(t)
+
+	if len(rc.bodies) != 2 || string(rc.bodies[0]) != string(rc.bodies[1]) {
+		t.Errorf("deliveries = %d, want the same event twice", len(rc.bodies))
+	}
+}
+
+func TestWebhookDoesNotRetryClientErrors(t *testing.T) {
+	rc := useWebhookReceiver(t, http.StatusBadRequest)
+	notifyWebhook(eventUserDeleted, map[string]interface{}{"user_id": "user-1"})
+	waitForWebhooks(t)
+
+	if len(rc.bodies) != 1 {
+		t.Errorf("deliveries = %d, want 1", len(rc.bodies))
+	}
+}
+
+func TestNotifyWebhookDisabled(t *testing.T) {
+	rc := useWebhookReceiver(t)
+	webhookURL = ""
+	notifyWebhook(eventUserDeleted, map[string]interface{}{"user_id": "user-1"})
+	waitForWebhooks(t)
+
+	if len(rc.bodies) != 0 {
+		t.Errorf("deliveries = %d, want none", len(rc.bodies))
+	}
+}
+
+func TestDeleteAccountSendsWebhooks(t *testing.T) {
+	openTestDB(t)
+	rc := useWebhookReceiver(t)
+	userID := createTestUser(t, 10000)
+	setTestPassword(t, userID, "hunter22")
+	betID, err := placeBet(userID, gamePoker, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleDeleteAccount(rec, userRequest("DELETE", "/api/account", userID, `{"password":"hunter22"}`))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	waitForWebhooks(t)
+
+	got := map[string]WebhookEvent{}
+	for _, body := range rc.bodies {
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatal(err)
+		}
+		got[event.Type] = event
+	}
+	if len(rc.bodies) != 2 || len(got) != 2 {
+		t.Fatalf("events = %v, want one force_closed and one deleted", got)
+	}
+	closed := got[eventSessionForceClosed].Data
+	if closed["session_id"] != betID || closed["game"] != gamePoker || closed["reason"] != reasonAccountClosed {
+		t.Errorf("%s data = %v", eventSessionForceClosed, closed)
+	}
+	if got[eventUserDeleted].Data["user_id"] != userID {
+		t.Errorf("%s data = %v", eventUserDeleted, got[eventUserDeleted].Data)
+	}
+}
@@ -61,7 +61,8 @@ class GameState(BaseModel):
     player_total: int
     dealer_total: int
     bet: int
-    status: str  # in_progress, player_bust, dealer_bust, player_win, dealer_win, push
+    insurance: int = 0
+    status: str  # in_progress, player_bust, dealer_bust, player_win, dealer_win, push, surrendered
 
 
 # ----- Card helpers -----
@@ -108,10 +109,21 @@ def make_state(game: Dict[str, Any]) -> GameState:
         player_total=hand_total(p),
         dealer_total=hand_total(d),
         bet=game["bet"],
+        insurance=game.get("insurance", 0),
         status=game["status"]
     )
 
 
+def dealer_shows_ace(game: Dict[str, Any]) -> bool:
+    return game["dealer_hand"][0][:-1] == "A"
+
+
+def peek(game: Dict[str, Any]):
+    """Resolve a dealer blackjack held back while insurance was on offer."""
+    if game["status"] == "in_progress" and len(game["dealer_hand"]) == 2 and hand_total(game["dealer_hand"]) == 21:
+        game["status"] = "dealer_win"
+
+
 def dealer_play(game: Dict[str, Any]):
     """Dealer hits until 17+."""
     while hand_total(game["dealer_hand"]) < 17:
@@ -161,7 +173,9 @@ def start(req: StartRequest, x_user_id: str = Header(...)):
         game["status"] = "push"
     elif p_total == 21:
         game["status"] = "player_win"
-    elif d_total == 21:
+    elif d_total == 21 and not dealer_shows_ace(game):
+        # Against an ace the hand stays open so insurance can be offered;
+        # the dealer checks for blackjack on the player's first move.
         game["status"] = "dealer_win"
 
     set_game(x_user_id, game)
@@ -172,6 +186,9 @@ def hit(x_user_id: str = Header(...)):
     game = get_game(x_user_id)
     if game["status"] != "in_progress":
         raise HTTPException(status_code=400, detail=f"Round is not active: {game['status']}")
+    peek(game)
+    if game["status"] != "in_progress":
+        return make_state(game)
 
     game["player_hand"].append(draw(game["deck"]))
 
@@ -185,11 +202,46 @@ def stand(x_user_id: str = Header(...)):
     game = get_game(x_user_id)
     if game["status"] != "in_progress":
         raise HTTPException(status_code=400, detail=f"Round is not active: {game['status']}")
+    peek(game)
+    if game["status"] != "in_progress":
+        return make_state(game)
 
     dealer_play(game)
     resolve(game)
     return make_state(game)
 
+@app.post("/blackjack/surrender", response_model=GameState)
+def surrender(x_user_id: str = Header(...)):
+    """Give up the hand before drawing. The caller refunds half the bet."""
+    game = get_game(x_user_id)
+    if game["status"] != "in_progress":
+        raise HTTPException(status_code=400, detail=f"Round is not active: {game['status']}")
+    if len(game["player_hand"]) != 2:
+        raise HTTPException(status_code=400, detail="Surrender is only allowed before hitting.")
+    peek(game)
+    if game["status"] != "in_progress":
+        return make_state(game)
+
+    game["status"] = "surrendered"
+    return make_state(game)
+
+@app.post("/blackjack/insurance", response_model=GameState)
+def insurance(x_user_id: str = Header(...)):
+    """Insure against a dealer blackjack for half the bet, then check for it.
+    A dealer blackjack ends the hand as dealer_win; the caller pays the
+    insurance stake 2:1. Otherwise the stake is lost and play continues."""
+    game = get_game(x_user_id)
+    if game["status"] != "in_progress":
+        raise HTTPException(status_code=400, detail=f"Round is not active: {game['status']}")
+    if not dealer_shows_ace(game) or len(game["player_hand"]) != 2:
+        raise HTTPException(status_code=400, detail="Insurance is only offered against a dealer ace before hitting.")
+    if game.get("insurance"):
+        raise HTTPException(status_code=400, detail="Insurance has already been taken.")
+
+    game["insurance"] = game["bet"] // 2
+    peek(game)
+    return make_state(game)
+
 @app.get("/blackjack/state", response_model=GameState)
 def get_state(x_user_id: str = Header(...)):
     game = get_game(x_user_id)
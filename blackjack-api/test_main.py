@@ -2,7 +2,7 @@
 import pytest
 from fastapi.testclient import TestClient
 
-from main import app, SESSIONS
+from main import app, SESSIONS, set_game
 
 client = TestClient(app)
 
@@ -72,6 +72,91 @@ class TestGameFlow:
         assert resp.status_code == 400
 
 
+class TestSurrender:
+    """Test giving up a hand before drawing."""
+
+    def deal(self, user_id, player):
+        set_game(user_id, {
+            "deck": ["2S", "3S", "4S"],
+            "player_hand": player,
+            "dealer_hand": ["9H", "7D"],
+            "bet": 51,
+            "status": "in_progress",
+        })
+
+    def test_surrender(self):
+        self.deal("user-1", ["10S", "6H"])
+        resp = client.post("/blackjack/surrender", headers={"X-User-ID": "user-1"})
+        assert resp.status_code == 200
+        data = resp.json()
+        assert data["status"] == "surrendered"
+        assert data["bet"] == 51
+
+    def test_surrender_after_hit(self):
+        self.deal("user-1", ["10S", "2H", "3C"])
+        resp = client.post("/blackjack/surrender", headers={"X-User-ID": "user-1"})
+        assert resp.status_code == 400
+
+    def test_surrender_twice(self):
+        self.deal("user-1", ["10S", "6H"])
+        client.post("/blackjack/surrender", headers={"X-User-ID": "user-1"})
+        resp = client.post("/blackjack/surrender", headers={"X-User-ID": "user-1"})
+        assert resp.status_code == 400
+
+    def test_surrender_without_start(self):
+        resp = client.post("/blackjack/surrender", headers={"X-User-ID": "no-game-user"})
+        assert resp.status_code == 400
+
+
+class TestInsurance:
+    """Test insurance against a dealer ace."""
+
+    def deal(self, user_id, dealer):
+        set_game(user_id, {
+            "deck": ["2S", "3S", "4S"],
+            "player_hand": ["10S", "6H"],
+            "dealer_hand": dealer,
+            "bet": 51,
+            "status": "in_progress",
+        })
+
+    def test_dealer_blackjack(self):
+        self.deal("user-1", ["AH", "KD"])
+        resp = client.post("/blackjack/insurance", headers={"X-User-ID": "user-1"})
+        assert resp.status_code == 200
+        data = resp.json()
+        assert data["status"] == "dealer_win"
+        assert data["insurance"] == 25
+
+    def test_no_dealer_blackjack(self):
+        self.deal("user-1", ["AH", "7D"])
+        resp = client.post("/blackjack/insurance", headers={"X-User-ID": "user-1"})
+        assert resp.status_code == 200
+        data = resp.json()
+        assert data["status"] == "in_progress"
+        assert data["insurance"] == 25
+
+    def test_insurance_twice(self):
+        self.deal("user-1", ["AH", "7D"])
+        client.post("/blackjack/insurance", headers={"X-User-ID": "user-1"})
+        resp = client.post("/blackjack/insurance", headers={"X-User-ID": "user-1"})
+        assert resp.status_code == 400
+
+    def test_no_ace(self):
+        self.deal("user-1", ["KH", "7D"])
+        resp = client.post("/blackjack/insurance", headers={"X-User-ID": "user-1"})
+        assert resp.status_code == 400
+
+    def test_declined_dealer_blackjack(self):
+        """Without insurance, the dealer's blackjack ends the hand on the next move."""
+        self.deal("user-1", ["AH", "KD"])
+        resp = client.post("/blackjack/hit", headers={"X-User-ID": "user-1"})
+        assert resp.status_code == 200
+        data = resp.json()
+        assert data["status"] == "dealer_win"
+        assert len(data["player_hand"]) == 2
+
+
 class TestSessionIsolation:
     """Test that different users get independent game sessions."""
 
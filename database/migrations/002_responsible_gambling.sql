@@ -0,0 +1,16 @@
+-- =============================================================================
+-- 002_responsible_gambling.sql - Loss limits and self-exclusion
+-- =============================================================================
+-- period_loss_cents is the net amount lost since period_started_at; the
+-- backend resets it once the configured period has elapsed.
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS loss_limit_cents BIGINT CHECK (loss_limit_cents > 0);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS loss_limit_period VARCHAR(10) CHECK (loss_limit_period IN ('daily', 'weekly'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS period_loss_cents BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS period_started_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS self_excluded_until TIMESTAMPTZ;
+
+COMMIT;
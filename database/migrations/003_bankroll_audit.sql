@@ -0,0 +1,22 @@
+-- =============================================================================
+-- 003_bankroll_audit.sql - Audit trail for bankroll changes
+-- =============================================================================
+-- The backend writes one row per balance change in the same transaction as
+-- the update. user_id has no foreign key so rows survive account deletion.
+-- =============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS bankroll_audit (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    delta_cents BIGINT NOT NULL,
+    balance_before_cents BIGINT NOT NULL,
+    balance_after_cents BIGINT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS bankroll_audit_user_created_idx ON bankroll_audit (user_id, created_at);
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- =============================================================================
+-- 004_bankroll_audit_note.sql - Reason text for admin bankroll corrections
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE bankroll_audit ADD COLUMN IF NOT EXISTS note TEXT;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- =============================================================================
+-- 005_user_roles.sql - Player/admin roles
+-- =============================================================================
+-- Existing users become players. Promote staff with:
+--   UPDATE users SET role = 'admin' WHERE email = '...';
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'player' CHECK (role IN ('player', 'admin'));
+
+COMMIT;
@@ -0,0 +1,16 @@
+-- =============================================================================
+-- 006_email_verification.sql - Require verified email before play
+-- =============================================================================
+-- The column is added with DEFAULT TRUE so every existing account is
+-- grandfathered as verified, then the default flips for new registrations.
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ALTER COLUMN email_verified SET DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_token_hash VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_sent_at TIMESTAMPTZ;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_verification_token_idx ON users (email_verification_token_hash);
+
+COMMIT;
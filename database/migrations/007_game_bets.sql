@@ -0,0 +1,24 @@
+-- =============================================================================
+-- 007_game_bets.sql - Record each bet so payouts use our own amounts
+-- =============================================================================
+-- Hands already in progress when this is applied have no row and settle
+-- without a payout; deploy between hands or refund them manually.
+-- =============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS game_bets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    game VARCHAR(20) NOT NULL,
+    bet_cents BIGINT NOT NULL CHECK (bet_cents > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'won', 'lost', 'push', 'refunded', 'abandoned', 'disputed')),
+    payout_cents BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    settled_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS game_bets_user_active_idx ON game_bets (user_id, game) WHERE status = 'active';
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- =============================================================================
+-- 008_bet_fairness.sql - Commit/reveal seeds for provably fair games
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS server_seed_hash VARCHAR(64);
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS server_seed VARCHAR(64);
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS client_seed VARCHAR(64);
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- =============================================================================
+-- 009_email_lower_index.sql - Case-insensitive unique emails
+-- =============================================================================
+-- Existing emails are lowercased and lower(email) gets a unique index, so
+-- "Foo@x.com" and "foo@x.com" cannot both register. If two accounts already
+-- differ only by case the migration stops; merge or rename one and re-run.
+-- =============================================================================
+
+BEGIN;
+
+DO $$
+DECLARE
+    dupes TEXT;
+BEGIN
+    SELECT string_agg(lower_email, ', ') INTO dupes
+    FROM (
+        SELECT lower(email) AS lower_email FROM users
+        GROUP BY lower(email) HAVING count(*) > 1
+    ) d;
+    IF dupes IS NOT NULL THEN
+        RAISE EXCEPTION 'accounts differ only by email case: %', dupes;
+    END IF;
+END $$;
+
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+DROP INDEX IF EXISTS users_email_lower_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- =============================================================================
+-- 010_promo_codes.sql - Registration promo codes
+-- =============================================================================
+-- A redeemed code adds bonus_cents to the new account's starting bankroll and
+-- is recorded in bankroll_audit with reason 'promo_bonus'.
+-- =============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS promo_codes (
+    code VARCHAR(32) PRIMARY KEY CHECK (code = upper(code)),
+    bonus_cents BIGINT NOT NULL CHECK (bonus_cents > 0),
+    max_uses INTEGER CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- =============================================================================
+-- 011_bet_reversal.sql - Allow reversed bets
+-- =============================================================================
+-- POST /api/admin/sessions/{id}/reverse undoes a settled bet's bankroll
+-- effect (audited as 'bet_reversal') and marks the bet 'reversed'.
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE game_bets DROP CONSTRAINT IF EXISTS game_bets_status_check;
+ALTER TABLE game_bets ADD CONSTRAINT game_bets_status_check
+    CHECK (status IN ('active', 'won', 'lost', 'push', 'refunded', 'abandoned', 'disputed', 'reversed'));
+
+COMMIT;
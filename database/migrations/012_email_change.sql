@@ -0,0 +1,15 @@
+-- =============================================================================
+-- 012_email_change.sql - Verified email changes
+-- =============================================================================
+-- POST /api/auth/email/change stores the new address here with a token hash;
+-- GET /api/auth/email/confirm moves it into users.email.
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_change_token_hash VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_change_sent_at TIMESTAMPTZ;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_change_token_idx ON users (email_change_token_hash);
+
+COMMIT;
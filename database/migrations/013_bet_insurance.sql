@@ -0,0 +1,13 @@
+-- =============================================================================
+-- 013_bet_insurance.sql - Blackjack insurance side bets
+-- =============================================================================
+-- POST /api/blackjack/insurance stakes half the hand's bet against a dealer
+-- blackjack. The stake and its payout are stored on the hand's game_bets row.
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS insurance_cents BIGINT CHECK (insurance_cents > 0);
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS insurance_payout_cents BIGINT;
+
+COMMIT;
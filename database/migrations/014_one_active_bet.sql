@@ -0,0 +1,22 @@
+-- =============================================================================
+-- 014_one_active_bet.sql - At most one active bet per user and game
+-- =============================================================================
+-- Starting a hand used to abandon any open one. The backend now rejects the
+-- second start with 409 GAME_IN_PROGRESS, enforced by a unique index. Any
+-- duplicates left by earlier races are abandoned, keeping the newest.
+-- =============================================================================
+
+BEGIN;
+
+UPDATE game_bets b SET status = 'abandoned', settled_at = now()
+WHERE status = 'active'
+  AND EXISTS (
+      SELECT 1 FROM game_bets newer
+      WHERE newer.user_id = b.user_id AND newer.game = b.game
+        AND newer.status = 'active' AND newer.created_at > b.created_at
+  );
+
+DROP INDEX IF EXISTS game_bets_user_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS game_bets_user_active_key ON game_bets (user_id, game) WHERE status = 'active';
+
+COMMIT;
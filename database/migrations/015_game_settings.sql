@@ -0,0 +1,21 @@
+-- =============================================================================
+-- 015_game_settings.sql - Admin-managed per-game settings
+-- =============================================================================
+-- PATCH /api/admin/games/{game} stores whether a game takes new bets, an
+-- optional bet range and a description here. Games without a row are enabled
+-- with no extra range, so no rows are seeded.
+-- =============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS game_settings (
+    game VARCHAR(20) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    min_bet_cents BIGINT CHECK (min_bet_cents > 0),
+    max_bet_cents BIGINT CHECK (max_bet_cents > 0),
+    description TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (min_bet_cents <= max_bet_cents)
+);
+
+COMMIT;
@@ -0,0 +1,32 @@
+-- =============================================================================
+-- 016_audit_category.sql - Structured category on bankroll_audit
+-- =============================================================================
+-- Each bankroll change gets a category (bet, win, loss, push, deposit,
+-- withdraw, bonus, refund, reversal, adjustment) alongside its detailed
+-- reason, so transactions can be filtered without matching reason strings.
+-- Existing rows are backfilled from their reason.
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE bankroll_audit ADD COLUMN IF NOT EXISTS category VARCHAR(20);
+
+UPDATE bankroll_audit SET category = CASE
+    WHEN reason IN ('blackjack_bet', 'poker_bet', 'coinflip_bet', 'blackjack_insurance') THEN 'bet'
+    WHEN reason IN ('blackjack_win', 'poker_win', 'coinflip_win', 'blackjack_insurance_win') THEN 'win'
+    WHEN reason = 'blackjack_push' THEN 'push'
+    WHEN reason IN ('blackjack_refund', 'poker_refund', 'coinflip_refund', 'blackjack_surrender') THEN 'refund'
+    WHEN reason = 'promo_bonus' THEN 'bonus'
+    WHEN reason = 'bet_reversal' THEN 'reversal'
+    WHEN reason = 'account_closed' THEN 'withdraw'
+    ELSE 'adjustment'
+END
+WHERE category IS NULL;
+
+ALTER TABLE bankroll_audit ALTER COLUMN category SET NOT NULL;
+ALTER TABLE bankroll_audit DROP CONSTRAINT IF EXISTS bankroll_audit_category_check;
+ALTER TABLE bankroll_audit ADD CONSTRAINT bankroll_audit_category_check
+    CHECK (category IN ('bet', 'win', 'loss', 'push', 'deposit', 'withdraw', 'bonus', 'refund', 'reversal', 'adjustment'));
+CREATE INDEX IF NOT EXISTS bankroll_audit_user_category_idx ON bankroll_audit (user_id, category, created_at);
+
+COMMIT;
@@ -0,0 +1,20 @@
+-- =============================================================================
+-- 017_fairness_seeds.sql - Server seeds committed before the bet
+-- =============================================================================
+-- Each user has one pending server seed whose hash is issued before they
+-- bet, and a nonce that counts their provably fair bets. A bet takes the
+-- pending seed and nonce and records the nonce alongside its seed. Bets
+-- drawn before this migration keep a NULL nonce.
+-- =============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS fairness_seeds (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    server_seed VARCHAR(64),
+    next_nonce BIGINT NOT NULL DEFAULT 0 CHECK (next_nonce >= 0)
+);
+
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS nonce BIGINT;
+
+COMMIT;
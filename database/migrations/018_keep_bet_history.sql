@@ -0,0 +1,16 @@
+-- =============================================================================
+-- 018_keep_bet_history.sql - Keep bets when an account is deleted
+-- =============================================================================
+-- Deleting a user used to cascade to their game_bets rows, erasing bet
+-- history that bankroll_audit still refers to. The bets now stay with a
+-- NULL user_id instead.
+-- =============================================================================
+
+BEGIN;
+
+ALTER TABLE game_bets ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE game_bets DROP CONSTRAINT IF EXISTS game_bets_user_id_fkey;
+ALTER TABLE game_bets ADD CONSTRAINT game_bets_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+COMMIT;
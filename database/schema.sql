@@ -44,3 +44,174 @@ EXECUTE FUNCTION set_updated_at();
 -- Previously this trigger deleted users on zero bankroll, which was too aggressive.
 DROP TRIGGER IF EXISTS users_delete_on_zero_bankroll ON users;
 DROP FUNCTION IF EXISTS delete_user_on_zero_bankroll();
+
+-- Responsible-gambling controls: per-period loss limit and self-exclusion.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS loss_limit_cents BIGINT CHECK (loss_limit_cents > 0);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS loss_limit_period VARCHAR(10) CHECK (loss_limit_period IN ('daily', 'weekly'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS period_loss_cents BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS period_started_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS self_excluded_until TIMESTAMPTZ;
+
+-- Append-only record of every bankroll change. user_id deliberately has no
+-- foreign key so the trail outlives a deleted account.
+CREATE TABLE IF NOT EXISTS bankroll_audit (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    delta_cents BIGINT NOT NULL,
+    balance_before_cents BIGINT NOT NULL,
+    balance_after_cents BIGINT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS bankroll_audit_user_created_idx ON bankroll_audit (user_id, created_at);
+
+-- Free-text explanation for staff corrections.
+ALTER TABLE bankroll_audit ADD COLUMN IF NOT EXISTS note TEXT;
+
+-- Authorization role; admin unlocks /api/admin/* for logged-in staff.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'player' CHECK (role IN ('player', 'admin'));
+
+-- Email verification. Accounts created before verification existed are
+-- grandfathered: the column is added as TRUE for them, as in migration 006,
+-- then new rows default to unverified.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ALTER COLUMN email_verified SET DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_token_hash VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_sent_at TIMESTAMPTZ;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_verification_token_idx ON users (email_verification_token_hash);
+
+-- Bets recorded at hand start. Payouts are computed from bet_cents, never
+-- from amounts reported by the game services.
+CREATE TABLE IF NOT EXISTS game_bets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    game VARCHAR(20) NOT NULL,
+    bet_cents BIGINT NOT NULL CHECK (bet_cents > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'won', 'lost', 'push', 'refunded', 'abandoned', 'disputed')),
+    payout_cents BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    settled_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS game_bets_user_active_idx ON game_bets (user_id, game) WHERE status = 'active';
+
+-- Provable fairness for games drawn in the backend: the seed hash is stored
+-- before the outcome is drawn and the seed once the bet settles.
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS server_seed_hash VARCHAR(64);
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS server_seed VARCHAR(64);
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS client_seed VARCHAR(64);
+
+-- Emails are stored lowercase and unique regardless of case. Accounts that
+-- differ only by case must be merged by hand before this will apply.
+DO $$
+DECLARE
+    dupes TEXT;
+BEGIN
+    SELECT string_agg(lower_email, ', ') INTO dupes
+    FROM (
+        SELECT lower(email) AS lower_email FROM users
+        GROUP BY lower(email) HAVING count(*) > 1
+    ) d;
+    IF dupes IS NOT NULL THEN
+        RAISE EXCEPTION 'accounts differ only by email case: %', dupes;
+    END IF;
+END $$;
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+DROP INDEX IF EXISTS users_email_lower_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
+
+-- Registration promo codes. max_uses and expires_at are optional; NULL means
+-- unlimited. Codes are stored uppercase and matched case-insensitively.
+CREATE TABLE IF NOT EXISTS promo_codes (
+    code VARCHAR(32) PRIMARY KEY CHECK (code = upper(code)),
+    bonus_cents BIGINT NOT NULL CHECK (bonus_cents > 0),
+    max_uses INTEGER CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Admins can reverse a settled bet; it is then marked 'reversed'.
+ALTER TABLE game_bets DROP CONSTRAINT IF EXISTS game_bets_status_check;
+ALTER TABLE game_bets ADD CONSTRAINT game_bets_status_check
+    CHECK (status IN ('active', 'won', 'lost', 'push', 'refunded', 'abandoned', 'disputed', 'reversed'));
+
+-- Email changes wait in pending_email until the link sent to the new
+-- address is followed.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_change_token_hash VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_change_sent_at TIMESTAMPTZ;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_change_token_idx ON users (email_change_token_hash);
+
+-- Blackjack insurance: the side bet's stake and payout, kept apart from the
+-- hand's own bet_cents and payout_cents.
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS insurance_cents BIGINT CHECK (insurance_cents > 0);
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS insurance_payout_cents BIGINT;
+
+-- One active bet per user and game: a second start while a hand is open is
+-- rejected with 409 instead of staking another bet on the same hand. Any
+-- duplicates left by earlier races are abandoned first, keeping the newest,
+-- as in migration 014.
+UPDATE game_bets b SET status = 'abandoned', settled_at = now()
+WHERE status = 'active'
+  AND EXISTS (
+      SELECT 1 FROM game_bets newer
+      WHERE newer.user_id = b.user_id AND newer.game = b.game
+        AND newer.status = 'active' AND newer.created_at > b.created_at
+  );
+
+DROP INDEX IF EXISTS game_bets_user_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS game_bets_user_active_key ON game_bets (user_id, game) WHERE status = 'active';
+
+-- Admin-managed per-game settings. A game without a row takes bets with no
+-- range beyond its own rules.
+CREATE TABLE IF NOT EXISTS game_settings (
+    game VARCHAR(20) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    min_bet_cents BIGINT CHECK (min_bet_cents > 0),
+    max_bet_cents BIGINT CHECK (max_bet_cents > 0),
+    description TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (min_bet_cents <= max_bet_cents)
+);
+
+-- Structured category for each bankroll change, alongside the detailed
+-- reason. Rows written before it existed are filled in from the reason.
+ALTER TABLE bankroll_audit ADD COLUMN IF NOT EXISTS category VARCHAR(20);
+
+UPDATE bankroll_audit SET category = CASE
+    WHEN reason IN ('blackjack_bet', 'poker_bet', 'coinflip_bet', 'blackjack_insurance') THEN 'bet'
+    WHEN reason IN ('blackjack_win', 'poker_win', 'coinflip_win', 'blackjack_insurance_win') THEN 'win'
+    WHEN reason = 'blackjack_push' THEN 'push'
+    WHEN reason IN ('blackjack_refund', 'poker_refund', 'coinflip_refund', 'blackjack_surrender') THEN 'refund'
+    WHEN reason = 'promo_bonus' THEN 'bonus'
+    WHEN reason = 'bet_reversal' THEN 'reversal'
+    WHEN reason = 'account_closed' THEN 'withdraw'
+    ELSE 'adjustment'
+END
+WHERE category IS NULL;
+
+ALTER TABLE bankroll_audit ALTER COLUMN category SET NOT NULL;
+ALTER TABLE bankroll_audit DROP CONSTRAINT IF EXISTS bankroll_audit_category_check;
+ALTER TABLE bankroll_audit ADD CONSTRAINT bankroll_audit_category_check
+    CHECK (category IN ('bet', 'win', 'loss', 'push', 'deposit', 'withdraw', 'bonus', 'refund', 'reversal', 'adjustment'));
+CREATE INDEX IF NOT EXISTS bankroll_audit_user_category_idx ON bankroll_audit (user_id, category, created_at);
+
+-- Pending server seed per user, issued (as its hash) before the bet it is
+-- used for, and the nonce for the user's next provably fair bet.
+CREATE TABLE IF NOT EXISTS fairness_seeds (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    server_seed VARCHAR(64),
+    next_nonce BIGINT NOT NULL DEFAULT 0 CHECK (next_nonce >= 0)
+);
+
+ALTER TABLE game_bets ADD COLUMN IF NOT EXISTS nonce BIGINT;
+
+-- Bets outlive a deleted account, without the user ID, so bet history stays
+-- auditable. Databases created before this still cascade; switch them over.
+ALTER TABLE game_bets ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE game_bets DROP CONSTRAINT IF EXISTS game_bets_user_id_fkey;
+ALTER TABLE game_bets ADD CONSTRAINT game_bets_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -35,6 +35,14 @@ if IS_WASM:
     # WASM mode: use JavaScript fetch via platform module
     from platform import window  # type: ignore[attr-defined]  # noqa: E402
 
+    def _csrf_token() -> str:
+        """Read the double-submit CSRF token cookie set by the Go backend."""
+        for part in str(window.document.cookie).split(";"):
+            name, _, value = part.strip().partition("=")
+            if name == "csrf_token":
+                return value
+        return ""
+
     def api_post(path: str, data: dict | None = None) -> dict:
         """POST request using JavaScript fetch (WASM/browser)."""
         url = _full_url(path)
@@ -48,6 +56,7 @@ if IS_WASM:
         xhr = window.XMLHttpRequest.new()
         xhr.open("POST", url, False)  # synchronous
         xhr.setRequestHeader("Content-Type", "application/json")
+        xhr.setRequestHeader("X-CSRF-Token", _csrf_token())
         if data is not None:
             xhr.send(json.dumps(data))
         else: